@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"errors"
+	"github.com/sagar290/migo/src"
+)
+
+// Exit codes, so scripts and CI can tell outcomes apart
+const (
+	ExitFailure          = 1
+	ExitPending          = 2
+	ExitLocked           = 3
+	ExitChecksumMismatch = 4
+)
+
+// ExitCode maps an error returned by a command to the process exit code
+func ExitCode(err error) int {
+	switch {
+	case errors.Is(err, src.ErrPendingMigrations):
+		return ExitPending
+	case errors.Is(err, src.ErrLockTimeout):
+		return ExitLocked
+	case errors.Is(err, src.ErrChecksumMismatch):
+		return ExitChecksumMismatch
+	default:
+		return ExitFailure
+	}
+}
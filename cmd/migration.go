@@ -4,60 +4,518 @@ import (
 	"context"
 	"fmt"
 	"github.com/sagar290/migo/common"
+	"github.com/sagar290/migo/src"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
 	"log"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
+	"text/tabwriter"
 	"time"
+	"unicode"
 )
 
-func UpScript(_ *cobra.Command, _ []string) {
+func UpScript(_ *cobra.Command, _ []string) error {
 
 	ctx := context.Background()
 
 	ctx = context.WithValue(ctx, common.StepsKey, steps)
 	ctx = context.WithValue(ctx, common.DryRunKey, dryRun)
+	ctx = context.WithValue(ctx, common.SingleTransactionKey, singleTransaction)
+	ctx = context.WithValue(ctx, common.ContinueOnErrorKey, continueOnError)
+	ctx = context.WithValue(ctx, common.IgnoreChecksumKey, ignoreChecksum)
 
-	err := migoInstance.Up(ctx)
-	if err != nil {
-		panic(err)
+	if allTenants && fleet {
+		return fmt.Errorf("--all-tenants and --fleet can't be combined")
+	}
+
+	if allTenants {
+		return upAllTenants(ctx)
+	}
+
+	if fleet {
+		return upFleet(ctx)
+	}
+
+	return migoInstance.Up(ctx)
+}
+
+func upAllTenants(ctx context.Context) error {
+
+	results, err := migoInstance.UpAllTenants(ctx)
+
+	if len(results) > 0 {
+		fmt.Println()
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "TENANT\tRESULT\tDURATION")
+
+		for _, result := range results {
+			if result.Err != nil {
+				fmt.Fprintf(w, "%s\t❌ %v\t%s\n", result.Schema, result.Err, result.Duration.Round(time.Millisecond))
+				continue
+			}
+
+			fmt.Fprintf(w, "%s\t✅ ok\t%s\n", result.Schema, result.Duration.Round(time.Millisecond))
+		}
+		w.Flush()
 	}
+
+	return err
 }
 
-func DownScript(_ *cobra.Command, _ []string) {
+func DownScript(_ *cobra.Command, _ []string) error {
 
 	ctx := context.Background()
 
 	ctx = context.WithValue(ctx, common.StepsKey, steps)
 	ctx = context.WithValue(ctx, common.DryRunKey, dryRun)
+	ctx = context.WithValue(ctx, common.SingleTransactionKey, singleTransaction)
+	ctx = context.WithValue(ctx, common.ContinueOnErrorKey, continueOnError)
+
+	ctx = context.WithValue(ctx, common.AllKey, rollbackAll)
+	ctx = context.WithValue(ctx, common.BatchKey, rollbackBatch)
+	ctx = context.WithValue(ctx, common.FileKey, rollbackFile)
+
+	return migoInstance.Rollback(ctx)
+}
+
+func ResetScript(_ *cobra.Command, _ []string) error {
+
+	ctx := context.Background()
+
+	ctx = context.WithValue(ctx, common.DryRunKey, dryRun)
+	ctx = context.WithValue(ctx, common.SingleTransactionKey, singleTransaction)
+	ctx = context.WithValue(ctx, common.ContinueOnErrorKey, continueOnError)
+
+	return migoInstance.Reset(ctx)
+}
+
+func RefreshScript(_ *cobra.Command, _ []string) error {
+
+	ctx := context.Background()
+
+	ctx = context.WithValue(ctx, common.DryRunKey, dryRun)
+	ctx = context.WithValue(ctx, common.SingleTransactionKey, singleTransaction)
+	ctx = context.WithValue(ctx, common.ContinueOnErrorKey, continueOnError)
+
+	return migoInstance.Refresh(ctx)
+}
+
+func FreshScript(_ *cobra.Command, _ []string) error {
+
+	ctx := context.Background()
+
+	return migoInstance.Fresh(ctx)
+}
+
+func GotoScript(_ *cobra.Command, args []string) error {
+
+	ctx := context.Background()
+
+	ctx = context.WithValue(ctx, common.DryRunKey, dryRun)
+	ctx = context.WithValue(ctx, common.ContinueOnErrorKey, continueOnError)
+	ctx = context.WithValue(ctx, common.IgnoreChecksumKey, ignoreChecksum)
+
+	return migoInstance.Goto(ctx, args[0])
+}
+
+func upFleet(ctx context.Context) error {
+
+	results, err := fleetInstance.Up(ctx)
+
+	if len(results) > 0 {
+		fmt.Println()
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "SHARD\tRESULT\tDURATION")
+
+		for _, result := range results {
+			switch {
+			case result.Skipped:
+				fmt.Fprintf(w, "%s\t⛔️ skipped\t-\n", result.Shard.Name)
+			case result.Err != nil:
+				fmt.Fprintf(w, "%s\t❌ %v\t%s\n", result.Shard.Name, result.Err, result.Duration.Round(time.Millisecond))
+			default:
+				fmt.Fprintf(w, "%s\t✅ ok\t%s\n", result.Shard.Name, result.Duration.Round(time.Millisecond))
+			}
+		}
+		w.Flush()
+	}
+
+	return err
+}
+
+func StatusScript(_ *cobra.Command, _ []string) error {
+
+	ctx := context.Background()
+
+	if fleet {
+		return statusFleet(ctx)
+	}
+
+	statuses, err := migoInstance.Status(ctx)
+	if err != nil {
+		return fmt.Errorf("read migration status: %w", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MIGRATION\tSTATUS\tBATCH\tAPPLIED AT\tDIRECTIVES")
+
+	pending := 0
+	outOfOrder := 0
+	missing := 0
+	for _, status := range statuses {
+		if status.Missing {
+			missing++
+			fmt.Fprintf(w, "%s\t❓ missing file%s\t%d\t%s\t-\n", status.Migration, irreversibleLabel(status.Irreversible), status.Batch, status.AppliedAt.Format("2006-01-02 15:04:05"))
+			continue
+		}
+
+		if status.OutOfOrder {
+			pending++
+			outOfOrder++
+			fmt.Fprintf(w, "%s\t⚠️ out of order\t-\t-\t%s\n", status.Migration, directivesLabel(status.Directives))
+			continue
+		}
+
+		if !status.Applied {
+			pending++
+			fmt.Fprintf(w, "%s\t⏳ pending\t-\t-\t%s\n", status.Migration, directivesLabel(status.Directives))
+			continue
+		}
+
+		fmt.Fprintf(w, "%s\t✅ applied%s\t%d\t%s\t%s\n", status.Migration, irreversibleLabel(status.Irreversible), status.Batch, status.AppliedAt.Format("2006-01-02 15:04:05"), directivesLabel(status.Directives))
+	}
+	w.Flush()
+
+	fmt.Printf("\n📋 %d migration(s): %d applied, %d pending\n", len(statuses), len(statuses)-pending, pending)
+
+	if missing > 0 {
+		fmt.Printf("⚠️ %d applied migration(s) have no file, run 'migo repair' to prune, rename or mark them irreversible\n", missing)
+	}
+
+	if outOfOrder > 0 {
+		fmt.Printf("⚠️ %d pending migration(s) are older than the newest applied migration, ", outOfOrder)
+
+		switch configInstance.GetOutOfOrderPolicy() {
+		case src.OutOfOrderAllow:
+			fmt.Println("'migo up' will apply them out of order (out_of_order: allow)")
+		case src.OutOfOrderWarn:
+			fmt.Println("'migo up' will apply them with a warning (out_of_order: warn)")
+		default:
+			fmt.Println("'migo up' refuses to run until they are resolved (set out_of_order: warn or allow, or pass --continue-on-error)")
+		}
+	}
+
+	if pending > 0 {
+		return fmt.Errorf("%w: %d", src.ErrPendingMigrations, pending)
+	}
+
+	return nil
+}
+
+// statusFleet prints one row per migration and one column per shard
+func statusFleet(ctx context.Context) error {
+
+	shards, err := fleetInstance.Status(ctx)
+	if err != nil {
+		return fmt.Errorf("read fleet status: %w", err)
+	}
+
+	cells := map[string][]string{}
+	var migrations []string
+
+	for i, shard := range shards {
+		for _, status := range shard.Statuses {
+			if _, ok := cells[status.Migration]; !ok {
+				cells[status.Migration] = make([]string, len(shards))
+				migrations = append(migrations, status.Migration)
+			}
+
+			switch {
+			case status.Missing:
+				cells[status.Migration][i] = "❓"
+			case status.Applied:
+				cells[status.Migration][i] = "✅"
+			default:
+				cells[status.Migration][i] = "⏳"
+			}
+		}
+	}
+	sort.Strings(migrations)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	fmt.Fprint(w, "MIGRATION")
+	for _, shard := range shards {
+		fmt.Fprintf(w, "\t%s", shard.Shard.Name)
+	}
+	fmt.Fprintln(w)
+
+	pending := 0
+	for _, migration := range migrations {
+		fmt.Fprint(w, migration)
+		for i, shard := range shards {
+			cell := cells[migration][i]
+			if shard.Err != nil {
+				cell = "-"
+			}
+			if cell == "" {
+				cell = "·"
+			}
+			if cell == "⏳" {
+				pending++
+			}
+			fmt.Fprintf(w, "\t%s", cell)
+		}
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprint(w, "VERSION")
+	for _, shard := range shards {
+		fmt.Fprintf(w, "\t%s", shardVersion(shard))
+	}
+	fmt.Fprintln(w)
+	w.Flush()
+
+	failed := 0
+	for _, shard := range shards {
+		if shard.Err != nil {
+			failed++
+			fmt.Printf("❌ %s: %v\n", shard.Shard.Name, shard.Err)
+		}
+	}
+
+	fmt.Printf("\n📋 %d shard(s), %d migration(s) pending across the fleet\n", len(shards), pending)
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d shard(s) could not be read", failed, len(shards))
+	}
+
+	if pending > 0 {
+		return fmt.Errorf("%w: %d", src.ErrPendingMigrations, pending)
+	}
+
+	return nil
+}
+
+// shardVersion is the newest applied migration of a shard, "ERR" when it could not be read
+func shardVersion(shard src.ShardStatus) string {
+
+	if shard.Err != nil {
+		return "ERR"
+	}
+
+	version := ""
+	for _, status := range shard.Statuses {
+		if v := src.MigrationVersion(status.Migration); status.Applied && (version == "" || src.CompareVersions(v, version) > 0) {
+			version = v
+		}
+	}
+
+	if version == "" {
+		return "-"
+	}
+
+	return version
+}
+
+func directivesLabel(directives src.Directives) string {
+	if label := directives.String(); label != "" {
+		return label
+	}
+
+	return "-"
+}
+
+func irreversibleLabel(irreversible bool) string {
+	if irreversible {
+		return " (irreversible)"
+	}
+
+	return ""
+}
+
+func RepairScript(_ *cobra.Command, _ []string) error {
+
+	ctx := context.Background()
+
+	statuses, err := migoInstance.Status(ctx)
+	if err != nil {
+		return fmt.Errorf("read migration status: %w", err)
+	}
+
+	found := 0
+	for _, status := range statuses {
+		if !status.Missing {
+			continue
+		}
+
+		found++
+		fmt.Printf("❓ %s (batch %d)%s\n", status.Migration, status.Batch, irreversibleLabel(status.Irreversible))
+	}
 
-	err := migoInstance.Rollback(ctx)
+	if found == 0 {
+		fmt.Println("✅ Every applied migration has a matching file")
+		return nil
+	}
+
+	fmt.Printf("\n⚠️ %d applied migration(s) have no file, use 'migo repair prune', 'rename' or 'irreversible'\n", found)
+
+	return nil
+}
+
+func RepairPruneScript(_ *cobra.Command, args []string) error {
+
+	ctx := context.Background()
+
+	pruned, err := migoInstance.PruneMigrations(ctx, args)
 	if err != nil {
-		panic(err)
+		return err
+	}
+
+	for _, file := range pruned {
+		log.Printf("🧹 Pruned %s", file)
 	}
+
+	return nil
 }
 
-func RefreshScript(_ *cobra.Command, _ []string) {
+func ImportScript(_ *cobra.Command, _ []string) error {
 
 	ctx := context.Background()
 
 	ctx = context.WithValue(ctx, common.DryRunKey, dryRun)
 
-	err := migoInstance.Refresh(ctx)
+	result, err := migoInstance.Import(ctx, src.ImportOptions{
+		From:      importFrom,
+		SourceDir: importSource,
+		Table:     importTable,
+	})
+	if err != nil {
+		return err
+	}
+
+	verb := "Imported"
+	if dryRun {
+		verb = "Would import"
+	}
+
+	for _, file := range result.Files {
+		if slices.Contains(result.Applied, file) {
+			log.Printf("📥 %s %s (applied)", verb, file)
+		} else {
+			log.Printf("📥 %s %s", verb, file)
+		}
+	}
+
+	log.Printf("✅ %d migrations, %d marked as applied", len(result.Files), len(result.Applied))
+
+	return nil
+}
+
+func ConfigShowScript(_ *cobra.Command, _ []string) error {
+
+	out, err := yaml.Marshal(configInstance.Masked())
+	if err != nil {
+		return fmt.Errorf("render config: %w", err)
+	}
+
+	fmt.Print(string(out))
+
+	return nil
+}
+
+func RepairRenameScript(_ *cobra.Command, args []string) error {
+
+	ctx := context.Background()
+
+	if err := migoInstance.RenameMigration(ctx, args[0], args[1]); err != nil {
+		return err
+	}
+
+	log.Printf("🔁 %s now tracks %s", args[0], args[1])
+
+	return nil
+}
+
+func RepairIrreversibleScript(_ *cobra.Command, args []string) error {
+
+	ctx := context.Background()
+
+	marked, err := migoInstance.MarkIrreversible(ctx, args)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range marked {
+		log.Printf("🔒 Marked %s as irreversible", file)
+	}
+
+	return nil
+}
+
+func VerifyScript(_ *cobra.Command, _ []string) error {
+
+	ctx := context.Background()
+
+	mismatches, err := migoInstance.Verify(ctx)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("verify migrations: %w", err)
 	}
+
+	if len(mismatches) == 0 {
+		fmt.Println("✅ All applied migrations match their files")
+		return nil
+	}
+
+	for _, mismatch := range mismatches {
+		fmt.Printf("❌ %s\n   applied:  %s\n   on disk:  %s\n", mismatch.Migration, mismatch.Expected, mismatch.Actual)
+	}
+
+	fmt.Println()
+
+	return fmt.Errorf("%w: %d file(s)", src.ErrChecksumMismatch, len(mismatches))
 }
 
-func FreshScript(_ *cobra.Command, _ []string) {
+func LockStatusScript(_ *cobra.Command, _ []string) error {
 
 	ctx := context.Background()
 
-	err := migoInstance.Fresh(ctx)
+	status, err := migoInstance.LockStatus(ctx)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("read lock status: %w", err)
+	}
+
+	if !status.Locked {
+		fmt.Println("🔓 Migration lock is free")
+		return nil
+	}
+
+	fmt.Printf("🔒 Migration lock is held by %s", status.Owner)
+	if !status.Since.IsZero() {
+		fmt.Printf(" since %s", status.Since.Format("2006-01-02 15:04:05"))
+	}
+	fmt.Println()
+
+	return nil
+}
+
+func UnlockScript(_ *cobra.Command, _ []string) error {
+
+	ctx := context.Background()
+
+	if err := migoInstance.ForceUnlock(ctx); err != nil {
+		return fmt.Errorf("release migration lock: %w", err)
 	}
+
+	log.Println("🔓 Migration lock released")
+
+	return nil
 }
 
 var fileTemplate = `[UP]
@@ -69,9 +527,37 @@ var fileTemplate = `[UP]
 [/DOWN]
 `
 
-func MakeScript(_ *cobra.Command, args []string) {
+var annotationFileTemplate = `-- migo:up
+
+-- migo:down
+
+`
+
+var goFileTemplate = `package %[1]s
+
+import (
+	"context"
+
+	"github.com/sagar290/migo/src"
+	"gorm.io/gorm"
+)
+
+func init() {
+	src.RegisterGoMigration("%[2]s", up%[3]s, down%[3]s)
+}
+
+func up%[3]s(ctx context.Context, tx *gorm.DB) error {
+	return nil
+}
+
+func down%[3]s(ctx context.Context, tx *gorm.DB) error {
+	return nil
+}
+`
+
+func MakeScript(_ *cobra.Command, args []string) error {
 	if len(args) == 0 {
-		log.Fatal("❌ Please provide a migration description")
+		return fmt.Errorf("please provide a migration description")
 	}
 
 	description := strings.Join(args, "_")
@@ -79,13 +565,57 @@ func MakeScript(_ *cobra.Command, args []string) {
 
 	timestamp := time.Now().Format("20060102150405")
 
-	fileName := fmt.Sprintf("%s_%s.sql", timestamp, description)
+	name := fmt.Sprintf("%s_%s", timestamp, description)
+	files := map[string]string{name + ".sql": fileTemplate}
+
+	switch {
+	case makeGo:
+		files = map[string]string{
+			name + ".go": fmt.Sprintf(goFileTemplate, goPackageName(configInstance.GetMigrationDir()), name, timestamp),
+		}
+	case makeFormat == "annotations":
+		files = map[string]string{name + ".sql": annotationFileTemplate}
+	case makeFormat == "paired":
+		files = map[string]string{name + src.UpFileSuffix: "", name + src.DownFileSuffix: ""}
+	case makeFormat != "tags":
+		return fmt.Errorf("unknown format %q, use tags, annotations or paired", makeFormat)
+	}
+
+	var created []string
+	for fileName, content := range files {
+		fullPath := filepath.Join(configInstance.GetMigrationDir(), fileName)
+
+		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+			return fmt.Errorf("create file: %w", err)
+		}
+
+		created = append(created, fileName)
+	}
+
+	sort.Sort(sort.Reverse(sort.StringSlice(created)))
+
+	log.Printf("✅ Created migration files:\n   %s\n", strings.Join(created, "\n   "))
+
+	return nil
+}
+
+// goPackageName derives the package clause for scaffolded Go migrations from the migrations dir
+func goPackageName(dir string) string {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "migrations"
+	}
 
-	fullPath := filepath.Join(configInstance.GetMigrationDir(), fileName)
+	name := strings.Map(func(r rune) rune {
+		if r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, filepath.Base(abs))
 
-	if err := os.WriteFile(fullPath, []byte(fileTemplate), 0644); err != nil {
-		log.Fatalf("❌ Failed to create file: %v", err)
+	if name == "" || unicode.IsDigit(rune(name[0])) {
+		return "migrations"
 	}
 
-	log.Printf("✅ Created migration files:\n   %s\n", fileName)
+	return name
 }
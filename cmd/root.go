@@ -1,23 +1,41 @@
 package cmd
 
 import (
+	"fmt"
 	"github.com/sagar290/migo/src"
 	"github.com/spf13/cobra"
-	"log"
 )
 
 var configFile string
+var envName string
+var dbTypeFlag, dbURLFlag, dirFlag string
 var migoInstance src.Migrator
+var fleetInstance *src.Fleet
 var configInstance *src.Config
 
 var (
-	steps  int
-	dryRun bool
+	steps             int
+	dryRun            bool
+	singleTransaction bool
+	ignoreChecksum    bool
+	makeGo            bool
+	makeFormat        string
+	allTenants        bool
+	fleet             bool
+	continueOnError   bool
+	rollbackAll       bool
+	rollbackBatch     int
+	rollbackFile      string
+	importFrom        string
+	importSource      string
+	importTable       string
 )
 
 var RootCmd = &cobra.Command{
-	Use:   "migo",
-	Short: "A lightweight database migration tool for Go",
+	Use:           "migo",
+	Short:         "A lightweight database migration tool for Go",
+	SilenceUsage:  true,
+	SilenceErrors: true,
 	Long: `
 Migo is a simple and flexible database migration tool built for Go developers. 
 It helps you create, run, and manage database migrations with ease, 
@@ -41,19 +59,39 @@ Examples:
   migo up
   migo up --steps=1     # Run only the next migration
   migo up --dry-run     # Preview pending migrations without applying
+  migo up --single-transaction  # Apply the whole batch atomically (Postgres, SQLite)
+  migo up --all-tenants         # Apply to every tenant schema from the tenants: config
+  migo up --fleet               # Apply to every database listed under shards:, stopping after a failure
 	`,
-	Run:    UpScript,
-	PreRun: preScript,
+	RunE:    UpScript,
+	PreRunE: preScript,
 }
 
 var DownCommand = &cobra.Command{
 	Use:   "down",
 	Short: "Rollback the last batch of migrations",
 	Long: `
-Reverts the most recent migrations applied to the database. Use --steps to rollback only N migrations.
+Reverts the most recent batch of migrations, newest file first. Use --steps to rollback only N migrations.
+
+Examples:
+  migo down
+  migo down --steps=1                          # Rollback only the newest migration
+  migo down --batch=3                          # Rollback batch 3 and every newer batch
+  migo down --file=20240101120000_users.sql    # Rollback one named migration
+  migo down --all                              # Rollback everything, same as 'migo reset'
+	`,
+	RunE:    DownScript,
+	PreRunE: preScript,
+}
+
+var ResetCommand = &cobra.Command{
+	Use:   "reset",
+	Short: "Rollback all migrations",
+	Long: `
+Rolls back every applied migration, newest batch first and in reverse file order inside each batch.
 	`,
-	Run:    DownScript,
-	PreRun: preScript,
+	RunE:    ResetScript,
+	PreRunE: preScript,
 }
 
 var RefreshCommand = &cobra.Command{
@@ -63,8 +101,8 @@ var RefreshCommand = &cobra.Command{
 Drops all applied migrations (by running Down in reverse) and then runs all Up migrations again.
 Useful in development to rebuild schema from scratch.
 	`,
-	Run:    RefreshScript,
-	PreRun: preScript,
+	RunE:    RefreshScript,
+	PreRunE: preScript,
 }
 
 var FreshCommand = &cobra.Command{
@@ -74,8 +112,160 @@ var FreshCommand = &cobra.Command{
 Drops all database tables (except the migrations table) and applies all migrations from scratch.
 Useful to get a clean schema during development.
 	`,
-	Run:    FreshScript,
-	PreRun: preScript,
+	RunE:    FreshScript,
+	PreRunE: preScript,
+}
+
+var GotoCommand = &cobra.Command{
+	Use:   "goto <version>",
+	Short: "Move the schema to a specific migration version",
+	Long: `
+Applies or rolls back migrations until the schema is exactly at the given version.
+Applied migrations newer than the version are rolled back newest first, across batches,
+and pending migrations up to the version are applied. Use 0 to roll back everything.
+
+Examples:
+  migo goto 20240101120000
+  migo goto 20240101120000 --dry-run   # Preview what would run
+	`,
+	Args:    cobra.ExactArgs(1),
+	RunE:    GotoScript,
+	PreRunE: preScript,
+}
+
+var StatusCommand = &cobra.Command{
+	Use:   "status",
+	Short: "Show applied and pending migrations",
+	Long: `
+Lists every migration file next to its row in the migrations table, showing whether it is
+applied or pending, its batch number and when it was applied.
+
+Exits with code 2 when there are pending migrations, so it can be used as a CI gate.
+With --fleet it shows a matrix of every migration against every database under shards:.
+	`,
+	RunE:    StatusScript,
+	PreRunE: preScript,
+}
+
+var VerifyCommand = &cobra.Command{
+	Use:   "verify",
+	Short: "Check applied migrations against their files",
+	Long: `
+Compares the checksum stored for every applied migration with the current content of its
+UP block and reports each file that was edited after it was applied.
+
+Exits with code 4 when a mismatch is found.
+	`,
+	RunE:    VerifyScript,
+	PreRunE: preScript,
+}
+
+var RepairCommand = &cobra.Command{
+	Use:   "repair",
+	Short: "List and repair applied migrations whose files are gone",
+	Long: `
+Without a subcommand, lists applied migrations that no longer have a matching file.
+
+Examples:
+  migo repair                                      # List orphaned migrations
+  migo repair prune                                # Delete the rows of every orphaned migration
+  migo repair prune 20240101120000_users.sql       # Delete one row
+  migo repair rename old_name.sql new_name.sql     # Point a row at a renamed file
+  migo repair irreversible                         # Mark orphaned migrations as irreversible
+	`,
+	RunE:    RepairScript,
+	PreRunE: preScript,
+}
+
+var RepairPruneCommand = &cobra.Command{
+	Use:     "prune [migration...]",
+	Short:   "Delete tracker rows of orphaned migrations",
+	RunE:    RepairPruneScript,
+	PreRunE: preScript,
+}
+
+var RepairRenameCommand = &cobra.Command{
+	Use:     "rename <old> <new>",
+	Short:   "Point an orphaned tracker row at a renamed migration file",
+	Args:    cobra.ExactArgs(2),
+	RunE:    RepairRenameScript,
+	PreRunE: preScript,
+}
+
+var RepairIrreversibleCommand = &cobra.Command{
+	Use:     "irreversible [migration...]",
+	Short:   "Mark orphaned migrations as irreversible so rollbacks stop at them",
+	RunE:    RepairIrreversibleScript,
+	PreRunE: preScript,
+}
+
+var LockCommand = &cobra.Command{
+	Use:   "lock",
+	Short: "Inspect the migration lock",
+	Long: `
+Migo takes a database lock while it runs migrations so concurrent 'migo up' runs cannot collide.
+It uses pg_advisory_lock on Postgres, GET_LOCK on MySQL and a lock table on SQLite.
+	`,
+}
+
+var LockStatusCommand = &cobra.Command{
+	Use:     "status",
+	Short:   "Show who holds the migration lock",
+	RunE:    LockStatusScript,
+	PreRunE: preScript,
+}
+
+var UnlockCommand = &cobra.Command{
+	Use:   "unlock",
+	Short: "Clear a stuck migration lock",
+	Long: `
+Releases the migration lock held by another process. On Postgres and MySQL the session
+holding the lock is terminated, on SQLite the lock row is removed.
+
+Only use this when the process holding the lock has crashed or hangs.
+	`,
+	RunE:    UnlockScript,
+	PreRunE: preScript,
+}
+
+var ImportCommand = &cobra.Command{
+	Use:   "import",
+	Short: "Convert migrations and history from goose, golang-migrate or Laravel",
+	Long: `
+Converts another tool's migration files into migo [UP]/[DOWN] files in the migrations directory
+and copies its tracking table into the migrations table, so an existing database shows as migrated.
+
+  goose           -- +goose Up / -- +goose Down files, history from goose_db_version
+  golang-migrate  NNN_name.up.sql / NNN_name.down.sql pairs, history from schema_migrations
+  laravel-sql     SQL exports named like Laravel migrations, history from migrations
+
+Examples:
+  migo import --from goose --source ./db/goose
+  migo import --from golang-migrate --source ./db/migrate --dry-run
+  migo import --from laravel-sql --source ./database/sql --table migrations
+	`,
+	RunE:    ImportScript,
+	PreRunE: preScript,
+}
+
+var ConfigCommand = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the resolved configuration",
+}
+
+var ConfigShowCommand = &cobra.Command{
+	Use:   "show",
+	Short: "Print the resolved config with secrets masked",
+	Long: `
+Prints the configuration migo runs with, after the selected environment is applied over the
+shared base. Passwords in the database URL are masked.
+
+Examples:
+  migo config show
+  migo config show --env prod
+	`,
+	RunE:    ConfigShowScript,
+	PreRunE: loadConfigScript,
 }
 
 var MakeCommand = &cobra.Command{
@@ -83,41 +273,124 @@ var MakeCommand = &cobra.Command{
 	Short: "Create a new migration file",
 	Long: `Generate new migration files with a timestamp prefix.
 Example:
-  migo make "create table for driver"`,
-	Run:    MakeScript,
-	PreRun: preScript,
+  migo make "create table for driver"
+  migo make --go "reencode user emails"   # scaffold a Go migration
+  migo make --format=paired "add tags"    # NNN_add_tags.up.sql and NNN_add_tags.down.sql
+  migo make --format=annotations "x"      # -- migo:up / -- migo:down comments`,
+	RunE:    MakeScript,
+	PreRunE: loadConfigScript,
 }
 
 func Init() {
 
 	UpCommand.Flags().IntVar(&steps, "steps", 0, "Number of migrations to run (0 = all)")
 	UpCommand.Flags().BoolVar(&dryRun, "dry-run", false, "Preview pending migrations without applying")
+	UpCommand.Flags().BoolVar(&singleTransaction, "single-transaction", false, "Wrap the whole batch in one transaction")
+	UpCommand.Flags().BoolVar(&continueOnError, "continue-on-error", false, "Keep running later migrations after one fails, out-of-order files are applied with a warning")
+	UpCommand.Flags().BoolVar(&ignoreChecksum, "ignore-checksum", false, "Run even when applied migration files were edited")
+	UpCommand.Flags().BoolVar(&allTenants, "all-tenants", false, "Apply to every schema listed or found by tenants: in the config")
+	UpCommand.Flags().BoolVar(&fleet, "fleet", false, "Apply to every shard listed under shards: in the config")
+	StatusCommand.Flags().BoolVar(&fleet, "fleet", false, "Show the status of every shard listed under shards: in the config")
 
 	DownCommand.Flags().IntVar(&steps, "steps", 0, "Number of migrations to run (0 = all)")
 	DownCommand.Flags().BoolVar(&dryRun, "dry-run", false, "Preview pending migrations without applying")
+	DownCommand.Flags().BoolVar(&continueOnError, "continue-on-error", false, "Keep rolling back after one migration fails")
+	DownCommand.Flags().BoolVar(&rollbackAll, "all", false, "Rollback every applied migration")
+	DownCommand.Flags().IntVar(&rollbackBatch, "batch", 0, "Rollback this batch and every newer one")
+	DownCommand.Flags().StringVar(&rollbackFile, "file", "", "Rollback one migration by name or version")
+	DownCommand.MarkFlagsMutuallyExclusive("all", "batch", "file")
+	DownCommand.Flags().BoolVar(&singleTransaction, "single-transaction", false, "Wrap the whole batch in one transaction")
+
+	ResetCommand.Flags().BoolVar(&dryRun, "dry-run", false, "Preview migrations without rolling back")
+	ResetCommand.Flags().BoolVar(&continueOnError, "continue-on-error", false, "Keep rolling back after one migration fails")
+	ResetCommand.Flags().BoolVar(&singleTransaction, "single-transaction", false, "Wrap the whole rollback in one transaction")
+
+	RefreshCommand.Flags().BoolVar(&dryRun, "dry-run", false, "Preview migrations without applying")
+	RefreshCommand.Flags().BoolVar(&continueOnError, "continue-on-error", false, "Keep going after one migration fails")
+	RefreshCommand.Flags().BoolVar(&singleTransaction, "single-transaction", false, "Wrap each phase in one transaction")
+
+	MakeCommand.Flags().BoolVar(&makeGo, "go", false, "Scaffold a Go migration instead of a SQL file")
+	MakeCommand.Flags().StringVar(&makeFormat, "format", "tags", "SQL file layout: tags, annotations or paired")
+
+	GotoCommand.Flags().BoolVar(&dryRun, "dry-run", false, "Preview migrations without applying or rolling back")
+	GotoCommand.Flags().BoolVar(&continueOnError, "continue-on-error", false, "Keep going after one migration fails")
+	GotoCommand.Flags().BoolVar(&ignoreChecksum, "ignore-checksum", false, "Apply even when applied migration files were edited")
 
 	RootCmd.AddCommand(UpCommand)
 	RootCmd.AddCommand(DownCommand)
+	RootCmd.AddCommand(ResetCommand)
 	RootCmd.AddCommand(RefreshCommand)
 	RootCmd.AddCommand(FreshCommand)
+	ImportCommand.Flags().StringVar(&importFrom, "from", "", "Tool to import from: goose, golang-migrate or laravel-sql")
+	ImportCommand.Flags().StringVar(&importSource, "source", "", "Directory holding the tool's migration files")
+	ImportCommand.Flags().StringVar(&importTable, "table", "", "Tracking table of the tool (defaults to the tool's own)")
+	ImportCommand.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would be converted without writing anything")
+	ImportCommand.MarkFlagRequired("from")
+	ImportCommand.MarkFlagRequired("source")
+
 	RootCmd.AddCommand(MakeCommand)
+	RootCmd.AddCommand(ImportCommand)
+	RootCmd.AddCommand(GotoCommand)
+	RootCmd.AddCommand(StatusCommand)
+	RootCmd.AddCommand(VerifyCommand)
+
+	RepairCommand.AddCommand(RepairPruneCommand)
+	RepairCommand.AddCommand(RepairRenameCommand)
+	RepairCommand.AddCommand(RepairIrreversibleCommand)
+	RootCmd.AddCommand(RepairCommand)
+
+	ConfigCommand.AddCommand(ConfigShowCommand)
+	RootCmd.AddCommand(ConfigCommand)
 
-	RootCmd.PersistentFlags().StringVarP(&configFile, "file", "f", "migo.yaml", "Path to config file")
+	LockCommand.AddCommand(LockStatusCommand)
+	RootCmd.AddCommand(LockCommand)
+	RootCmd.AddCommand(UnlockCommand)
+
+	RootCmd.PersistentFlags().StringVarP(&configFile, "file", "f", "", "Path to config file (default: migo.yaml in the current or a parent directory)")
+	RootCmd.PersistentFlags().StringVar(&dbTypeFlag, "db-type", "", "Database type, overrides db_type and MIGO_DB_TYPE")
+	RootCmd.PersistentFlags().StringVar(&dbURLFlag, "db-url", "", "Database URL, overrides db_url and MIGO_DB_URL")
+	RootCmd.PersistentFlags().StringVar(&dirFlag, "dir", "", "Migrations directory, overrides migrations_dir and MIGO_MIGRATIONS_DIR")
+	RootCmd.PersistentFlags().StringVar(&envName, "env", "", "Environment from the config's environments: section (defaults to $MIGO_ENV)")
 }
 
-func preScript(cmd *cobra.Command, args []string) {
+func preScript(cmd *cobra.Command, args []string) error {
+
+	if err := loadConfigScript(cmd, args); err != nil {
+		return err
+	}
+
+	// fleet commands connect to each shard themselves
+	if fleet {
+		fleetInstance = src.NewFleet(configInstance, src.NewTracker(configInstance))
+		return nil
+	}
 
-	config, err := src.LoadConfig(configFile)
+	var err error
+	migoInstance, err = src.NewMigo(configInstance, src.NewTracker(configInstance))
 	if err != nil {
-		log.Fatal("⚠️ config error:", err)
-		return
+		return fmt.Errorf("migoInstance error: %w", err)
 	}
 
-	migoInstance, err = src.NewMigo(config, src.NewTracker(config))
+	return nil
+}
+
+// loadConfigScript only resolves the config, for commands that don't need a database
+func loadConfigScript(_ *cobra.Command, _ []string) error {
+
+	config, err := src.LoadConfigWithOptions(src.ConfigOptions{
+		File: configFile,
+		Env:  envName,
+		Overrides: map[string]string{
+			"db_type":        dbTypeFlag,
+			"db_url":         dbURLFlag,
+			"migrations_dir": dirFlag,
+		},
+	})
 	if err != nil {
-		log.Fatal("⚠️ migoInstance error:", err)
-		return
+		return fmt.Errorf("config error: %w", err)
 	}
 
 	configInstance = config
+
+	return nil
 }
@@ -7,6 +7,13 @@ type ctxKey string
 const (
 	StepsKey  ctxKey = "steps"
 	DryRunKey ctxKey = "dryRun"
+	BatchKey  ctxKey = "batch"
+	FileKey   ctxKey = "file"
+	AllKey    ctxKey = "all"
+
+	SingleTransactionKey ctxKey = "singleTransaction"
+	IgnoreChecksumKey    ctxKey = "ignoreChecksum"
+	ContinueOnErrorKey   ctxKey = "continueOnError"
 )
 
 func GetEnv(key, fallback string) string {
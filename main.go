@@ -12,7 +12,7 @@ func main() {
 
 	if err := cmd.RootCmd.Execute(); err != nil {
 		fmt.Println("❌", err)
-		os.Exit(1)
+		os.Exit(cmd.ExitCode(err))
 	}
 
 }
@@ -0,0 +1,117 @@
+package src
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"strings"
+)
+
+// ErrChecksumMismatch is returned when an applied migration file was edited afterwards
+var ErrChecksumMismatch = errors.New("applied migration files changed")
+
+type ChecksumMismatch struct {
+	Migration string
+	Expected  string
+	Actual    string
+}
+
+// ChecksumOf returns the sha256 hex digest of a migration block
+func ChecksumOf(block string) string {
+	sum := sha256.Sum256([]byte(block))
+	return hex.EncodeToString(sum[:])
+}
+
+// Verify compares every applied migration against its file on disk.
+// Rows without a stored checksum and files that no longer exist are skipped.
+func (r *Runner) Verify(ctx context.Context) ([]ChecksumMismatch, error) {
+
+	err := r.Tracker.InitTracker(ctx, r.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.verifyChecksums()
+}
+
+func (r *Runner) verifyChecksums() ([]ChecksumMismatch, error) {
+
+	var mismatches []ChecksumMismatch
+
+	for _, record := range r.Tracker.GetAppliedMigrationRecords() {
+		if record.Checksum == "" {
+			continue
+		}
+
+		actual, err := r.Tracker.Checksum(record.Migration)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if actual == "" {
+			continue
+		}
+
+		if actual != record.Checksum {
+			mismatches = append(mismatches, ChecksumMismatch{
+				Migration: record.Migration,
+				Expected:  record.Checksum,
+				Actual:    actual,
+			})
+		}
+	}
+
+	return mismatches, nil
+}
+
+// checkChecksums refuses to continue when applied files changed, then records
+// checksums for rows applied before checksums were tracked
+func (r *Runner) checkChecksums(ctx context.Context) error {
+
+	mismatches, err := r.verifyChecksums()
+	if err != nil {
+		return err
+	}
+
+	if len(mismatches) > 0 {
+		var files []string
+		for _, mismatch := range mismatches {
+			files = append(files, mismatch.Migration)
+		}
+
+		return fmt.Errorf("%w: %s (run 'migo verify' for details or pass --ignore-checksum)", ErrChecksumMismatch, strings.Join(files, ", "))
+	}
+
+	for _, record := range r.Tracker.GetAppliedMigrationRecords() {
+		if record.Checksum != "" {
+			continue
+		}
+
+		checksum, err := r.Tracker.Checksum(record.Migration)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if checksum == "" {
+			continue
+		}
+
+		if err := r.Tracker.UpdateChecksum(ctx, r.DB, record.Migration, checksum); err != nil {
+			return err
+		}
+
+		log.Printf("🔏 Recorded checksum for %s", record.Migration)
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+package src
+
+import (
+	"context"
+	"errors"
+	"github.com/sagar290/migo/common"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestUpRefusesChangedMigrations(t *testing.T) {
+	source := fstest.MapFS{
+		"001_users.sql": migrationFile("CREATE TABLE users (id INTEGER);", "DROP TABLE users;"),
+	}
+	runner := sqliteRunner(t, &Config{}, source)
+	ctx := context.Background()
+
+	if err := runner.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	mismatches, err := runner.Verify(ctx)
+	if err != nil || len(mismatches) != 0 {
+		t.Fatalf("Verify = %+v, %v, want no mismatches", mismatches, err)
+	}
+
+	source["001_users.sql"] = migrationFile("CREATE TABLE users (id INTEGER, name TEXT);", "DROP TABLE users;")
+	source["002_posts.sql"] = migrationFile("CREATE TABLE posts (id INTEGER);", "DROP TABLE posts;")
+
+	mismatches, err = runner.Verify(ctx)
+	if err != nil || len(mismatches) != 1 || mismatches[0].Migration != "001_users.sql" {
+		t.Fatalf("Verify = %+v, %v, want 001_users.sql", mismatches, err)
+	}
+	if mismatches[0].Expected == mismatches[0].Actual {
+		t.Errorf("mismatch has equal checksums: %+v", mismatches[0])
+	}
+
+	if err := runner.Up(ctx); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("Up = %v, want ErrChecksumMismatch", err)
+	}
+	if got := appliedNames(t, runner); !reflect.DeepEqual(got, []string{"001_users.sql:1"}) {
+		t.Errorf("applied after refused Up = %v", got)
+	}
+
+	if err := runner.Up(context.WithValue(ctx, common.IgnoreChecksumKey, true)); err != nil {
+		t.Fatalf("Up --ignore-checksum: %v", err)
+	}
+	if got := appliedNames(t, runner); !reflect.DeepEqual(got, []string{"001_users.sql:1", "002_posts.sql:2"}) {
+		t.Errorf("applied after --ignore-checksum = %v", got)
+	}
+
+	// the stored checksum is left alone, the edit is still reported
+	if err := runner.Up(ctx); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Up after --ignore-checksum = %v, want ErrChecksumMismatch", err)
+	}
+}
+
+func TestUpBackfillsMissingChecksums(t *testing.T) {
+	source := fstest.MapFS{
+		"001_users.sql": migrationFile("CREATE TABLE users (id INTEGER);", "DROP TABLE users;"),
+	}
+	runner := sqliteRunner(t, &Config{}, source)
+	ctx := context.Background()
+
+	if err := runner.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	want := appliedRecords(t, runner)[0].Checksum
+	if want == "" {
+		t.Fatal("Up recorded no checksum")
+	}
+
+	// a row written before checksums were tracked
+	if err := runner.DB.Exec(`UPDATE migo_migrations SET checksum = ''`).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// without a stored checksum the file can't be checked, it is not a mismatch
+	source["001_users.sql"] = migrationFile("CREATE TABLE users (id INTEGER, name TEXT);", "DROP TABLE users;")
+	if mismatches, err := runner.Verify(ctx); err != nil || len(mismatches) != 0 {
+		t.Fatalf("Verify = %+v, %v, want nothing to compare", mismatches, err)
+	}
+
+	if err := runner.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	got := appliedRecords(t, runner)[0].Checksum
+	if got == "" || got == want {
+		t.Errorf("checksum = %q, want the current file's, recorded once", got)
+	}
+
+	if err := runner.Up(ctx); err != nil {
+		t.Errorf("Up after backfill: %v", err)
+	}
+}
@@ -1,66 +1,369 @@
 package src
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/spf13/viper"
 	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
 	"strings"
+	"time"
 )
 
 type Config struct {
-	DBType         string `mapstructure:"db_type"`
-	DBURL          string `mapstructure:"db_url"`
-	MigrationsDir  string `mapstructure:"migrations_dir"`
-	LogLevel       string `mapstructure:"log_level"`
-	Schema         string `mapstructure:"schema"`
-	MigrationTable string `mapstructure:"migration_table"`
+	DBType         string        `mapstructure:"db_type" yaml:"db_type"`
+	DBURL          string        `mapstructure:"db_url" yaml:"db_url,omitempty"`
+	MigrationsDir  string        `mapstructure:"migrations_dir" yaml:"migrations_dir,omitempty"`
+	LogLevel       string        `mapstructure:"log_level" yaml:"log_level,omitempty"`
+	Schema         string        `mapstructure:"schema" yaml:"schema,omitempty"`
+	MigrationTable string        `mapstructure:"migration_table" yaml:"migration_table,omitempty"`
+	LockTimeout    time.Duration `mapstructure:"lock_timeout" yaml:"-"`
+
+	OutOfOrder      string `mapstructure:"out_of_order" yaml:"out_of_order,omitempty"`
+	AllowOutOfOrder bool   `mapstructure:"allow_out_of_order" yaml:"allow_out_of_order,omitempty"`
+
+	// Discrete connection fields, used to build the DSN when db_url is empty
+	Host     string            `mapstructure:"host" yaml:"host,omitempty"`
+	Port     int               `mapstructure:"port" yaml:"port,omitempty"`
+	User     string            `mapstructure:"user" yaml:"user,omitempty"`
+	Database string            `mapstructure:"database" yaml:"database,omitempty"`
+	SSLMode  string            `mapstructure:"sslmode" yaml:"sslmode,omitempty"`
+	Params   map[string]string `mapstructure:"params" yaml:"params,omitempty"`
+
+	// Password sources, at most one may be set
+	PasswordFile    string `mapstructure:"password_file" yaml:"password_file,omitempty"`
+	PasswordEnv     string `mapstructure:"password_env" yaml:"password_env,omitempty"`
+	PasswordCommand string `mapstructure:"password_command" yaml:"password_command,omitempty"`
+
+	// Vars are available to migration SQL as {{ .Vars.name }}, names are lower-cased by the config loader
+	Vars map[string]string `mapstructure:"vars" yaml:"vars,omitempty"`
+
+	// Tenants are the schemas migrated by 'migo up --all-tenants'
+	Tenants TenantConfig `mapstructure:"tenants" yaml:"tenants,omitempty"`
+
+	// Role is switched to with SET ROLE on every connection, before session_init
+	Role string `mapstructure:"role" yaml:"role,omitempty"`
+	// SessionInit statements run on every connection before it is used, including reconnects
+	SessionInit []string `mapstructure:"session_init" yaml:"session_init,omitempty"`
+
+	// ShardDSNs are the databases 'migo up --fleet' and 'migo status --fleet' run against
+	ShardDSNs []string `mapstructure:"shards" yaml:"shards,omitempty"`
+	// ShardParallelism is how many shards are migrated at once, 1 when unset
+	ShardParallelism int `mapstructure:"shard_parallelism" yaml:"shard_parallelism,omitempty"`
+
+	// Environment is the entry of environments: the config was resolved with, empty for the base
+	Environment string `mapstructure:"-" yaml:"environment,omitempty"`
+	// File is the config file that was read, empty when running from env vars and flags only
+	File string `mapstructure:"-" yaml:"file,omitempty"`
+}
+
+// ConfigFileNames are looked for in the working directory and each of its parents
+var ConfigFileNames = []string{"migo.yaml", "migo.yml"}
+
+// ConfigOptions pick the config file and environment and override single keys.
+//
+// Precedence, highest first: Overrides (CLI flags), MIGO_* env vars, the selected
+// environments: entry, the base keys of the file.
+type ConfigOptions struct {
+	// File is the config path, empty searches for ConfigFileNames and runs without a file when none is found
+	File string
+	// Env selects an entry of environments:, empty falls back to MIGO_ENV
+	Env string
+	// Overrides set config keys such as "db_url", empty values are ignored
+	Overrides map[string]string
 }
 
+// LoadConfig loads the config file with the environment named by MIGO_ENV, if any
 func LoadConfig(configFile string) (*Config, error) {
+	return LoadConfigWithOptions(ConfigOptions{File: configFile})
+}
 
-	if configFile == "" {
-		return nil, fmt.Errorf("no config file found")
-	}
+// LoadEnvConfig loads the config file and applies the keys of one entry of its environments:
+// section over the shared base. An empty env falls back to MIGO_ENV.
+func LoadEnvConfig(configFile string, env string) (*Config, error) {
+	return LoadConfigWithOptions(ConfigOptions{File: configFile, Env: env})
+}
 
-	parts := strings.Split(configFile, ".")
+// LoadConfigWithOptions resolves the config from an optional file, env vars and overrides
+func LoadConfigWithOptions(opts ConfigOptions) (*Config, error) {
 
-	if len(parts) != 2 {
-		return nil, fmt.Errorf("invalid config file format")
+	path := opts.File
+	if path == "" {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+
+		path = FindConfigFile(cwd)
 	}
 
-	fmt.Println(parts)
 	v := viper.New()
 
-	v.SetConfigName(parts[0])
-	v.SetConfigType(parts[1])
-	v.AddConfigPath(".")
+	if path != "" {
+		settings, err := readConfigFile(path)
+		if err != nil {
+			return nil, err
+		}
 
-	v.AutomaticEnv()
+		if err := v.MergeConfigMap(settings); err != nil {
+			return nil, err
+		}
+	}
+
+	env := opts.Env
+	if env == "" {
+		env = os.Getenv("MIGO_ENV")
+	}
+
+	if err := applyEnvironment(v, env, filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+
+	// viper.Sub and Unmarshal only see env vars for keys they know, so every key is bound up front
 	v.SetEnvPrefix("MIGO")
 	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
 
-	if err := v.ReadInConfig(); err != nil {
-		log.Println("⚠️ migo.yaml not found or failed to load:", err)
+	for _, key := range configKeys() {
+		if err := v.BindEnv(key); err != nil {
+			return nil, err
+		}
 	}
 
-	sub := v.Sub("migo")
-	if sub == nil {
-		log.Println("⚠️ No 'migo' section found in config file")
-		sub = v
+	// MIGO_MIGRATION_DIR was documented before the key was spelled out
+	if err := v.BindEnv("migrations_dir", "MIGO_MIGRATIONS_DIR", "MIGO_MIGRATION_DIR"); err != nil {
+		return nil, err
+	}
+
+	for key, value := range opts.Overrides {
+		if value != "" {
+			v.Set(key, value)
+		}
 	}
 
 	var cfg *Config
-	if err := sub.Unmarshal(&cfg); err != nil {
+	if err := v.Unmarshal(&cfg); err != nil {
 		return nil, err
 	}
 
-	if cfg.DBType == "" || cfg.DBURL == "" {
-		return nil, fmt.Errorf("missing required env: MIGO_DB_TYPE or MIGO_DB_URL")
+	cfg.Environment = strings.ToLower(env)
+	cfg.File = path
+
+	// a fleet-only config has no database of its own
+	if len(cfg.ShardDSNs) > 0 {
+		return cfg, nil
+	}
+
+	if cfg.DBType == "" || !cfg.HasConnection() {
+		if path == "" {
+			return nil, fmt.Errorf("no migo.yaml found and db_type/db_url are not set: use MIGO_DB_TYPE and MIGO_DB_URL or --db-type and --db-url")
+		}
+
+		return nil, fmt.Errorf("%s: db_type and either db_url or host/database are required (or MIGO_DB_TYPE/MIGO_DB_URL, --db-type/--db-url)", path)
 	}
 
 	return cfg, nil
 }
 
+// FindConfigFile looks for ConfigFileNames in dir and its parents, empty when there is none
+func FindConfigFile(dir string) string {
+	for {
+		for _, name := range ConfigFileNames {
+			candidate := filepath.Join(dir, name)
+			if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+				return candidate
+			}
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+
+		dir = parent
+	}
+}
+
+// readConfigFile returns the migo: section of a config file, or the whole file when it has none.
+// ${VAR} references in its values are expanded, a relative migrations_dir is resolved against the file's directory.
+func readConfigFile(path string) (map[string]interface{}, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+
+	configType := strings.TrimPrefix(filepath.Ext(path), ".")
+	if configType == "" {
+		configType = "yaml"
+	}
+
+	file := viper.New()
+	file.SetConfigType(configType)
+
+	if err := file.ReadConfig(bytes.NewReader(content)); err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+
+	settings := file.AllSettings()
+	if file.IsSet("migo") {
+		settings = file.GetStringMap("migo")
+	} else {
+		log.Printf("⚠️ No 'migo' section found in %s, reading top-level keys", path)
+	}
+
+	if err := interpolateSettings(settings); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	resolveMigrationsDir(settings, filepath.Dir(path))
+
+	return settings, nil
+}
+
+func resolveMigrationsDir(settings map[string]interface{}, base string) {
+	dir, ok := settings["migrations_dir"].(string)
+	if ok && dir != "" && !filepath.IsAbs(dir) {
+		settings["migrations_dir"] = filepath.Join(base, dir)
+	}
+}
+
+// configKeys lists the mapstructure keys of Config
+func configKeys() []string {
+	var keys []string
+
+	configType := reflect.TypeOf(Config{})
+	for i := 0; i < configType.NumField(); i++ {
+		key, _, _ := strings.Cut(configType.Field(i).Tag.Get("mapstructure"), ",")
+		if key != "" && key != "-" {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// applyEnvironment merges environments.<env> over the base keys
+func applyEnvironment(v *viper.Viper, env string, base string) error {
+	if env == "" {
+		return nil
+	}
+
+	environments := v.GetStringMap("environments")
+
+	overrides, ok := environments[strings.ToLower(env)].(map[string]interface{})
+	if !ok {
+		var names []string
+		for name := range environments {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		if len(names) == 0 {
+			return fmt.Errorf("unknown environment %q: the config defines no environments", env)
+		}
+
+		return fmt.Errorf("unknown environment %q, available: %s", env, strings.Join(names, ", "))
+	}
+
+	resolveMigrationsDir(overrides, base)
+
+	return v.MergeConfigMap(overrides)
+}
+
+// maskedValue replaces secrets in config output
+const maskedValue = "****"
+
+var (
+	dsnPasswordParam = regexp.MustCompile(`(?i)(password=)('[^']*'|[^\s&;]+)`)
+	dsnUserPassword  = regexp.MustCompile(`^([^:/@]+):(.*)@(\w*\(|/)`)
+)
+
+// Masked returns a copy of the config that is safe to print, passwords in DSNs and
+// secret-looking params are masked
+func (cfg *Config) Masked() Config {
+	masked := *cfg
+	masked.DBURL = MaskDSN(cfg.DBURL)
+
+	if cfg.Params != nil {
+		masked.Params = make(map[string]string, len(cfg.Params))
+		for key, value := range cfg.Params {
+			if isSecretParam(key) {
+				value = maskedValue
+			}
+
+			masked.Params[key] = value
+		}
+	}
+
+	masked.ShardDSNs = make([]string, len(cfg.ShardDSNs))
+	for i, dsn := range cfg.ShardDSNs {
+		masked.ShardDSNs[i] = MaskDSN(dsn)
+	}
+
+	return masked
+}
+
+// isSecretParam matches params such as password, sslpassword, passwd or auth_token
+func isSecretParam(key string) bool {
+	key = strings.ToLower(key)
+
+	for _, secret := range []string{"password", "passwd", "secret", "token"} {
+		if strings.Contains(key, secret) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MarshalYAML writes durations the way they are configured ("5m") instead of nanoseconds
+func (cfg Config) MarshalYAML() (interface{}, error) {
+	type plain Config
+
+	out := struct {
+		plain       `yaml:",inline"`
+		LockTimeout string `yaml:"lock_timeout,omitempty"`
+	}{plain: plain(cfg)}
+
+	if cfg.LockTimeout > 0 {
+		out.LockTimeout = cfg.LockTimeout.String()
+	}
+
+	return out, nil
+}
+
+// MaskDSN hides the password of a URL, key=value or MySQL user:password@ DSN
+func MaskDSN(dsn string) string {
+	// shards: marks MySQL DSNs with a mysql:// prefix
+	if len(dsn) > len("mysql://") && strings.EqualFold(dsn[:len("mysql://")], "mysql://") {
+		return dsn[:len("mysql://")] + MaskDSN(dsn[len("mysql://"):])
+	}
+
+	if strings.Contains(dsn, "://") {
+		if u, err := url.Parse(dsn); err == nil && u.User != nil {
+			if _, ok := u.User.Password(); ok {
+				// url escapes "*", so the mask goes in after encoding
+				u.User = url.UserPassword(u.User.Username(), "MASKED")
+				dsn = strings.Replace(u.String(), ":MASKED@", ":"+maskedValue+"@", 1)
+			}
+		}
+	} else {
+		dsn = dsnUserPassword.ReplaceAllString(dsn, "${1}:"+maskedValue+"@${3}")
+	}
+
+	return dsnPasswordParam.ReplaceAllString(dsn, "${1}"+maskedValue)
+}
+
+// HasConnection reports whether db_url or the connection fields are set
+func (cfg *Config) HasConnection() bool {
+	return cfg.DBURL != "" || cfg.Host != "" || cfg.Database != ""
+}
+
 func (cfg *Config) GetMigrationTable() string {
 	if cfg.MigrationTable != "" {
 		return cfg.MigrationTable
@@ -79,6 +382,33 @@ func (cfg *Config) GetSchemaName() string {
 	return "public"
 }
 
+// GetLockTimeout returns how long to wait for another migo process to release the lock
+func (cfg *Config) GetLockTimeout() time.Duration {
+	if cfg.LockTimeout > 0 {
+		return cfg.LockTimeout
+	}
+
+	return 5 * time.Minute
+}
+
+// GetOutOfOrderPolicy returns what to do with pending migrations older than the newest applied one.
+// allow_out_of_order: true is a shorthand for out_of_order: allow.
+func (cfg *Config) GetOutOfOrderPolicy() string {
+	if cfg.AllowOutOfOrder {
+		return OutOfOrderAllow
+	}
+
+	if cfg.OutOfOrder != "" {
+		return cfg.OutOfOrder
+	}
+
+	return OutOfOrderRefuse
+}
+
 func (cfg *Config) GetMigrationDir() string {
-	return cfg.MigrationsDir
+	if cfg.MigrationsDir != "" {
+		return cfg.MigrationsDir
+	}
+
+	return "."
 }
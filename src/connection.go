@@ -0,0 +1,92 @@
+package src
+
+import (
+	"context"
+	"fmt"
+	"github.com/sagar290/migo/common"
+	"io/fs"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// migrationSource is where a runner's migrations are read from, so the runners opened for
+// shards and tenants see the same files
+func migrationSource(cfg *Config, tracker MigrationTracker) fs.FS {
+
+	if tracker, ok := tracker.(*Tracker); ok && tracker.Source != nil {
+		return tracker.Source
+	}
+
+	return os.DirFS(cfg.GetMigrationDir())
+}
+
+// withConnection opens a runner of its own for cfg and closes its connection once run returns.
+// Unless ensure is set the schema and migrations table are not created, so dry runs and status
+// reads change nothing.
+func withConnection(cfg *Config, dbType string, dsn string, source fs.FS, ensure bool, run func(runner Migrator) error) error {
+
+	conn, err := connect(cfg, dbType, dsn)
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+
+	sqlDB, err := conn.DB()
+	if err != nil {
+		return err
+	}
+	defer sqlDB.Close()
+
+	if ensure {
+		if err := EnsureMigrationTable(conn, cfg); err != nil {
+			return fmt.Errorf("create migration table: %w", err)
+		}
+	}
+
+	runner, err := newRunner(cfg, conn, NewTrackerFS(cfg, source))
+	if err != nil {
+		return err
+	}
+
+	return run(runner)
+}
+
+// runEach calls run for every index up to n, at most parallelism at a time. Dry runs go
+// one at a time as their output would interleave. With stopOnFailure nothing new is started
+// after the first failure, the calls already running finish and the rest are marked skipped.
+func runEach(ctx context.Context, n int, parallelism int, stopOnFailure bool, run func(i int) error) (errs []error, skipped []bool) {
+
+	if dry, _ := ctx.Value(common.DryRunKey).(bool); dry || parallelism < 1 {
+		parallelism = 1
+	}
+
+	errs = make([]error, n)
+	skipped = make([]bool, n)
+	slots := make(chan struct{}, parallelism)
+
+	var failed atomic.Bool
+	var wg sync.WaitGroup
+
+	for i := 0; i < n; i++ {
+		slots <- struct{}{}
+
+		if stopOnFailure && failed.Load() {
+			<-slots
+			skipped[i] = true
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			if errs[i] = run(i); errs[i] != nil {
+				failed.Store(true)
+			}
+		}()
+	}
+	wg.Wait()
+
+	return errs, skipped
+}
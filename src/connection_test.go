@@ -0,0 +1,67 @@
+package src
+
+import (
+	"context"
+	"github.com/sagar290/migo/common"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestWithConnectionDryRunCreatesNothing(t *testing.T) {
+	cfg := &Config{DBType: "sqlite"}
+	dsn := filepath.Join(t.TempDir(), "dry.db")
+	source := fstest.MapFS{
+		"001_users.sql": migrationFile("CREATE TABLE users (id INTEGER);", "DROP TABLE users;"),
+	}
+
+	dry := context.WithValue(context.Background(), common.DryRunKey, true)
+
+	var statuses []MigrationStatus
+	err := withConnection(cfg, "sqlite", dsn, source, false, func(runner Migrator) error {
+		if err := runner.Up(dry); err != nil {
+			return err
+		}
+
+		var err error
+		statuses, err = runner.Status(dry)
+
+		return err
+	})
+	if err != nil {
+		t.Fatalf("dry run without a migrations table: %v", err)
+	}
+
+	if len(statuses) != 1 || statuses[0].Applied {
+		t.Errorf("statuses = %+v, want one pending migration", statuses)
+	}
+
+	conn, err := openDB("sqlite", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if sqlDB, err := conn.DB(); err == nil {
+			sqlDB.Close()
+		}
+	}()
+
+	var tables []string
+	if err := conn.Raw(`SELECT name FROM sqlite_master WHERE type = 'table'`).Scan(&tables).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(tables) != 0 {
+		t.Errorf("dry run created %v", tables)
+	}
+
+	err = withConnection(cfg, "sqlite", dsn, source, true, func(runner Migrator) error {
+		return runner.Up(context.Background())
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !conn.Migrator().HasTable("migo_migrations") || !conn.Migrator().HasTable("users") {
+		t.Error("Up with ensure didn't create the migrations table and apply the file")
+	}
+}
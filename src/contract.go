@@ -7,10 +7,27 @@ import (
 
 type Migrator interface {
 	Up(ctx context.Context) error
+	UpAllTenants(ctx context.Context) ([]TenantResult, error)
 	Rollback(ctx context.Context) error
+	Reset(ctx context.Context) error
 	Refresh(ctx context.Context) error
 	Fresh(ctx context.Context) error
-	Status(ctx context.Context) ([]MigoMigration, error)
+	Goto(ctx context.Context, version string) error
+	Status(ctx context.Context) ([]MigrationStatus, error)
+	LockStatus(ctx context.Context) (LockStatus, error)
+	ForceUnlock(ctx context.Context) error
+	Verify(ctx context.Context) ([]ChecksumMismatch, error)
+	PruneMigrations(ctx context.Context, files []string) ([]string, error)
+	RenameMigration(ctx context.Context, from string, to string) error
+	MarkIrreversible(ctx context.Context, files []string) ([]string, error)
+	Import(ctx context.Context, opts ImportOptions) (ImportResult, error)
+}
+
+type Locker interface {
+	Lock(ctx context.Context) error
+	Unlock(ctx context.Context) error
+	Status(ctx context.Context) (LockStatus, error)
+	ForceUnlock(ctx context.Context) error
 }
 
 type MigrationTracker interface {
@@ -19,11 +36,25 @@ type MigrationTracker interface {
 	FilterNewMigrations() error
 	ExtractUpBlock(file string) (string, error)
 	ExtractDownBlock(file string) (string, error)
+	LocateUpBlock(file string) (Block, error)
+	LocateDownBlock(file string) (Block, error)
+	UseTransaction(file string) (bool, error)
+	Directives(file string) (Directives, error)
+	Checksum(file string) (string, error)
+	GetGoMigration(file string) (*GoMigration, bool)
 	InitTracker(ctx context.Context, db *gorm.DB) error
 	GetMigrationFiles() []string
 	GetAppliedMigrations() []string
+	GetAppliedMigrationRecords() []MigoMigration
+	GetOutOfOrderMigrations() []string
+	GetOrphanedMigrations() []string
+	IsIrreversible(file string) bool
+	GetNewestAppliedVersion() string
 	AddMigrationInfo(ctx context.Context, db *gorm.DB, file string) error
 	RemoveMigrationInfo(ctx context.Context, db *gorm.DB, file string) error
+	UpdateChecksum(ctx context.Context, db *gorm.DB, file string, checksum string) error
+	RenameMigrationInfo(ctx context.Context, db *gorm.DB, from string, to string) error
+	MarkIrreversible(ctx context.Context, db *gorm.DB, file string) error
 	ListSqlFiles() error
 	GetAppliedMigrationFileByBatchId(batchId int) []string
 }
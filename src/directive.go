@@ -0,0 +1,296 @@
+package src
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"gorm.io/gorm"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DirectivePrefix starts every directive line in a migration file header
+const DirectivePrefix = "-- migo:"
+
+// retryDelay is the pause between attempts of a migration with a retry directive
+const retryDelay = time.Second
+
+// Directives are per-file execution options, read from "-- migo:" lines in the leading
+// comments of a migration file (the .up.sql half for paired files):
+//
+//	-- migo:no-transaction
+//	-- migo:timeout=30s
+//	-- migo:lock-timeout=5s
+//	-- migo:retry=3
+//	-- migo:irreversible
+//	-- migo:no-template
+type Directives struct {
+	// NoTransaction runs the file outside a transaction
+	NoTransaction bool
+	// Timeout cancels the migration when it runs longer
+	Timeout time.Duration
+	// LockTimeout limits how long a statement waits for table locks
+	LockTimeout time.Duration
+	// Retries is how many times a failed migration is run again
+	Retries int
+	// Irreversible refuses to roll the migration back
+	Irreversible bool
+	// NoTemplate runs the blocks as plain SQL, for SQL that contains "{{"
+	NoTemplate bool
+}
+
+// String lists the directives in header syntax, empty when none are set
+func (d Directives) String() string {
+	var parts []string
+
+	if d.NoTransaction {
+		parts = append(parts, "no-transaction")
+	}
+
+	if d.Timeout > 0 {
+		parts = append(parts, "timeout="+d.Timeout.String())
+	}
+
+	if d.LockTimeout > 0 {
+		parts = append(parts, "lock-timeout="+d.LockTimeout.String())
+	}
+
+	if d.Retries > 0 {
+		parts = append(parts, "retry="+strconv.Itoa(d.Retries))
+	}
+
+	if d.Irreversible {
+		parts = append(parts, "irreversible")
+	}
+
+	if d.NoTemplate {
+		parts = append(parts, "no-template")
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// ParseDirectives reads the directives from the file header, which ends at the first line
+// that is neither blank nor a comment, or at a block marker
+func ParseDirectives(content []byte) (Directives, error) {
+	var d Directives
+
+	scanner := bufio.NewScanner(strings.NewReader(string(content)))
+	lineNumber := 0
+
+	for scanner.Scan() {
+		trimmedLine := strings.TrimSpace(scanner.Text())
+		lineNumber++
+
+		if trimmedLine == "" {
+			continue
+		}
+
+		if !strings.HasPrefix(trimmedLine, "--") || isBlockMarker(trimmedLine) {
+			break
+		}
+
+		if !strings.HasPrefix(strings.ToLower(trimmedLine), DirectivePrefix) {
+			continue
+		}
+
+		name, value, _ := strings.Cut(strings.TrimSpace(trimmedLine[len(DirectivePrefix):]), "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		value = strings.TrimSpace(value)
+
+		var err error
+		switch name {
+		case "no-transaction":
+			d.NoTransaction = true
+		case "irreversible":
+			d.Irreversible = true
+		case "no-template":
+			d.NoTemplate = true
+		case "timeout":
+			d.Timeout, err = time.ParseDuration(value)
+		case "lock-timeout":
+			d.LockTimeout, err = time.ParseDuration(value)
+		case "retry":
+			d.Retries, err = strconv.Atoi(value)
+			if err == nil && d.Retries < 0 {
+				err = fmt.Errorf("must not be negative")
+			}
+		default:
+			return Directives{}, fmt.Errorf("line %d: unknown directive %q", lineNumber, trimmedLine)
+		}
+
+		if err != nil {
+			return Directives{}, fmt.Errorf("line %d: invalid %s directive %q: %w", lineNumber, name, value, err)
+		}
+	}
+
+	// a retry outside a transaction would run the statements that already succeeded again
+	if d.NoTransaction && d.Retries > 0 {
+		return Directives{}, fmt.Errorf("retry can't be combined with no-transaction")
+	}
+
+	return d, nil
+}
+
+// Directives returns the header directives of a migration file, Go migrations have none
+func (t *Tracker) Directives(file string) (Directives, error) {
+
+	if IsGoMigration(file) {
+		return Directives{}, nil
+	}
+
+	content, err := t.readFile(file)
+	if err != nil {
+		return Directives{}, err
+	}
+
+	d, err := ParseDirectives(content)
+	if err != nil {
+		return Directives{}, fmt.Errorf("%s: %w", file, err)
+	}
+
+	return d, nil
+}
+
+// execWithDirectives runs a migration with its timeout, lock timeout and retries applied
+func execWithDirectives(ctx context.Context, conn *gorm.DB, file string, d Directives, transactional bool, run func(tx *gorm.DB) error, track func(tx *gorm.DB) error) error {
+	var err error
+
+	// only a rolled back attempt can be run again, on MySQL or inside --single-transaction
+	// the statements that succeeded would be repeated
+	retries := d.Retries
+	if retries > 0 && !transactional {
+		log.Printf("⚠️ Ignoring retry=%d for %s: it doesn't run in a transaction of its own", retries, file)
+		retries = 0
+	}
+
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			log.Printf("🔁 Retrying %s (%d/%d) after: %v", file, attempt, retries, err)
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(retryDelay):
+			}
+		}
+
+		err = execAttempt(ctx, conn, d, transactional, run, track)
+		if err == nil {
+			return nil
+		}
+	}
+
+	return err
+}
+
+func execAttempt(ctx context.Context, conn *gorm.DB, d Directives, transactional bool, run func(tx *gorm.DB) error, track func(tx *gorm.DB) error) error {
+	if d.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.Timeout)
+		defer cancel()
+	}
+
+	conn = conn.WithContext(ctx)
+
+	if d.LockTimeout == 0 {
+		return execMigration(conn, transactional, run, track)
+	}
+
+	withLockTimeout := func(tx *gorm.DB) error {
+		reset, err := setLockTimeout(tx, d.LockTimeout, transactional)
+		if err != nil {
+			return fmt.Errorf("set lock timeout: %w", err)
+		}
+		defer reset()
+
+		if err := run(tx); err != nil {
+			return err
+		}
+
+		return track(tx)
+	}
+
+	if transactional {
+		return conn.Transaction(withLockTimeout)
+	}
+
+	// a session setting has to stay on one pooled connection, inside a
+	// --single-transaction run conn already is one
+	if _, ok := conn.Statement.ConnPool.(gorm.TxCommitter); ok {
+		return withLockTimeout(conn)
+	}
+
+	return conn.Connection(withLockTimeout)
+}
+
+// setLockTimeout limits lock waits on the session, local settings end with the transaction.
+// Session settings are restored to their previous value rather than the server default, which
+// would drop what session_init set.
+func setLockTimeout(tx *gorm.DB, timeout time.Duration, local bool) (func(), error) {
+	// a fresh session so the reset still runs after a failed statement left its error on tx
+	session := tx.Session(&gorm.Session{NewDB: true})
+
+	millis := timeout.Milliseconds()
+	seconds := int64(timeout.Seconds())
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	var set, reset []string
+
+	switch tx.Dialector.Name() {
+	case "postgres":
+		if local {
+			set = []string{fmt.Sprintf("SET LOCAL lock_timeout = %d", millis)}
+		} else {
+			var previous string
+			if err := session.Raw("SELECT current_setting('lock_timeout')").Row().Scan(&previous); err != nil {
+				return nil, err
+			}
+
+			set = []string{fmt.Sprintf("SET lock_timeout = %d", millis)}
+			reset = []string{fmt.Sprintf("SET lock_timeout = '%s'", strings.ReplaceAll(previous, "'", "''"))}
+		}
+	case "mysql":
+		var previousWait, previousInnodb int64
+		if err := session.Raw("SELECT @@SESSION.lock_wait_timeout, @@SESSION.innodb_lock_wait_timeout").Row().Scan(&previousWait, &previousInnodb); err != nil {
+			return nil, err
+		}
+
+		set = []string{
+			fmt.Sprintf("SET SESSION lock_wait_timeout = %d", seconds),
+			fmt.Sprintf("SET SESSION innodb_lock_wait_timeout = %d", seconds),
+		}
+		reset = []string{
+			fmt.Sprintf("SET SESSION lock_wait_timeout = %d", previousWait),
+			fmt.Sprintf("SET SESSION innodb_lock_wait_timeout = %d", previousInnodb),
+		}
+	case "sqlite":
+		var previous int64
+		if err := session.Raw("PRAGMA busy_timeout").Row().Scan(&previous); err != nil {
+			return nil, err
+		}
+
+		set = []string{fmt.Sprintf("PRAGMA busy_timeout = %d", millis)}
+		reset = []string{fmt.Sprintf("PRAGMA busy_timeout = %d", previous)}
+	default:
+		log.Printf("⚠️ lock-timeout is not supported on %s, ignoring it", tx.Dialector.Name())
+	}
+
+	for _, statement := range set {
+		if err := session.Exec(statement).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return func() {
+		for _, statement := range reset {
+			if err := session.Exec(statement).Error; err != nil {
+				log.Printf("⚠️ Failed to reset lock timeout: %v", err)
+			}
+		}
+	}, nil
+}
@@ -0,0 +1,156 @@
+package src
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseDirectives(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    Directives
+		wantErr bool
+	}{
+		{
+			name:    "no header",
+			content: "[UP]\nSELECT 1;\n[/UP]\n",
+			want:    Directives{},
+		},
+		{
+			name: "all directives",
+			content: "-- migo:timeout=30s\n-- migo:lock-timeout=5s\n" +
+				"-- migo:retry=3\n-- migo:irreversible\n-- migo:no-template\n[UP]\nSELECT 1;\n",
+			want: Directives{
+				Timeout:      30 * time.Second,
+				LockTimeout:  5 * time.Second,
+				Retries:      3,
+				Irreversible: true,
+				NoTemplate:   true,
+			},
+		},
+		{
+			name:    "case, spacing and plain comments",
+			content: "-- adds an index\n\n-- MIGO:No-Transaction\n--  migo:timeout = 1m\n-- migo:up\nSELECT 1;\n",
+			want:    Directives{NoTransaction: true},
+		},
+		{
+			name:    "header ends at the first statement",
+			content: "-- migo:retry=1\nSELECT 1;\n-- migo:irreversible\n",
+			want:    Directives{Retries: 1},
+		},
+		{
+			name:    "header ends at a block marker",
+			content: "[UP]\n-- migo:no-transaction\nSELECT 1;\n",
+			want:    Directives{},
+		},
+		{
+			name:    "annotation marker is not a directive",
+			content: "-- migo:up\n-- migo:no-transaction\nSELECT 1;\n",
+			want:    Directives{},
+		},
+		{
+			name:    "unknown directive",
+			content: "-- migo:no-transactions\n",
+			wantErr: true,
+		},
+		{
+			name:    "bad duration",
+			content: "-- migo:timeout=soon\n",
+			wantErr: true,
+		},
+		{
+			name:    "retry without a transaction",
+			content: "-- migo:no-transaction\n-- migo:retry=1\n",
+			wantErr: true,
+		},
+		{
+			name:    "negative retries",
+			content: "-- migo:retry=-1\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDirectives([]byte(tt.content))
+
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseDirectives() = %+v, want an error", got)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tt.want {
+				t.Errorf("ParseDirectives() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDirectivesString(t *testing.T) {
+	d := Directives{NoTransaction: true, Timeout: 30 * time.Second, Retries: 2}
+
+	if got, want := d.String(), "no-transaction, timeout=30s, retry=2"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	if got := (Directives{}).String(); got != "" {
+		t.Errorf("String() of no directives = %q", got)
+	}
+}
+
+func TestExecWithDirectivesRetries(t *testing.T) {
+	conn, err := openDB("sqlite", filepath.Join(t.TempDir(), "retry.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if sqlDB, err := conn.DB(); err == nil {
+			sqlDB.Close()
+		}
+	}()
+
+	tests := []struct {
+		name          string
+		transactional bool
+		wantAttempts  int
+		wantErr       bool
+	}{
+		{name: "transactional attempts are retried", transactional: true, wantAttempts: 2},
+		{name: "no retry outside a transaction", transactional: false, wantAttempts: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			run := func(tx *gorm.DB) error {
+				attempts++
+				if attempts == 1 {
+					return errors.New("deadlock detected")
+				}
+
+				return nil
+			}
+			track := func(tx *gorm.DB) error { return nil }
+
+			err := execWithDirectives(context.Background(), conn, "001_a.sql", Directives{Retries: 1}, tt.transactional, run, track)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, want error %v", err, tt.wantErr)
+			}
+
+			if attempts != tt.wantAttempts {
+				t.Errorf("ran %d time(s), want %d", attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
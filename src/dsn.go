@@ -0,0 +1,265 @@
+package src
+
+import (
+	"bytes"
+	"fmt"
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// envReference matches ${VAR} and ${VAR:-default} in config files
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// InterpolateEnv replaces ${VAR} and ${VAR:-default} in a config value with environment
+// values, a variable that is unset and has no default is an error
+func InterpolateEnv(value string) (string, error) {
+	var missing []string
+
+	out := expandEnv(value, &missing)
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variables not set: %s", strings.Join(missing, ", "))
+	}
+
+	return out, nil
+}
+
+// interpolateSettings expands env references in every string of parsed config settings,
+// so references in comments are never looked at
+func interpolateSettings(settings map[string]interface{}) error {
+	var missing []string
+
+	for key, value := range settings {
+		settings[key] = expandSetting(value, &missing)
+	}
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		missing = slices.Compact(missing)
+
+		return fmt.Errorf("environment variables not set: %s", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+func expandSetting(value interface{}, missing *[]string) interface{} {
+	switch value := value.(type) {
+	case string:
+		return expandEnv(value, missing)
+	case map[string]interface{}:
+		for key, nested := range value {
+			value[key] = expandSetting(nested, missing)
+		}
+	case []interface{}:
+		for i, nested := range value {
+			value[i] = expandSetting(nested, missing)
+		}
+	}
+
+	return value
+}
+
+func expandEnv(value string, missing *[]string) string {
+	return envReference.ReplaceAllStringFunc(value, func(match string) string {
+		parts := envReference.FindStringSubmatch(match)
+
+		if env, ok := os.LookupEnv(parts[1]); ok {
+			return env
+		}
+
+		if parts[2] != "" {
+			return parts[3]
+		}
+
+		*missing = append(*missing, parts[1])
+
+		return match
+	})
+}
+
+// DSN returns db_url when it is set, otherwise it builds the connection string for
+// db_type from host, port, user, database, sslmode, params and the password source
+func (cfg *Config) DSN() (string, error) {
+
+	if cfg.DBURL != "" {
+		return cfg.DBURL, nil
+	}
+
+	password, err := cfg.Password()
+	if err != nil {
+		return "", err
+	}
+
+	switch cfg.DBType {
+	case "postgres":
+		return cfg.postgresDSN(password), nil
+	case "mysql":
+		return cfg.mysqlDSN(password)
+	case "sqlite":
+		return cfg.sqliteDSN(), nil
+	default:
+		return "", fmt.Errorf("unsupported DB type: %s", cfg.DBType)
+	}
+}
+
+// Password reads the password from password_file, password_env or password_command,
+// empty when none is configured
+func (cfg *Config) Password() (string, error) {
+
+	sources := 0
+	for _, source := range []string{cfg.PasswordFile, cfg.PasswordEnv, cfg.PasswordCommand} {
+		if source != "" {
+			sources++
+		}
+	}
+
+	if sources > 1 {
+		return "", fmt.Errorf("set only one of password_file, password_env and password_command")
+	}
+
+	switch {
+	case cfg.PasswordFile != "":
+		content, err := os.ReadFile(cfg.PasswordFile)
+		if err != nil {
+			return "", fmt.Errorf("password_file: %w", err)
+		}
+
+		return strings.TrimRight(string(content), "\r\n"), nil
+
+	case cfg.PasswordEnv != "":
+		value, ok := os.LookupEnv(cfg.PasswordEnv)
+		if !ok {
+			return "", fmt.Errorf("password_env: %s is not set", cfg.PasswordEnv)
+		}
+
+		return value, nil
+
+	case cfg.PasswordCommand != "":
+		shell, flag := "sh", "-c"
+		if runtime.GOOS == "windows" {
+			shell, flag = "cmd", "/C"
+		}
+
+		var stderr bytes.Buffer
+		command := exec.Command(shell, flag, cfg.PasswordCommand)
+		command.Stderr = &stderr
+
+		out, err := command.Output()
+		if err != nil {
+			return "", fmt.Errorf("password_command: %w: %s", err, strings.TrimSpace(stderr.String()))
+		}
+
+		return strings.TrimRight(string(out), "\r\n"), nil
+	}
+
+	return "", nil
+}
+
+func (cfg *Config) hostPort(defaultPort int) string {
+	host := cfg.Host
+	if host == "" {
+		host = "localhost"
+	}
+
+	port := cfg.Port
+	if port == 0 {
+		port = defaultPort
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+func (cfg *Config) postgresDSN(password string) string {
+	u := url.URL{
+		Scheme: "postgres",
+		Host:   cfg.hostPort(5432),
+		Path:   "/" + cfg.Database,
+	}
+
+	if cfg.User != "" {
+		u.User = url.User(cfg.User)
+		if password != "" {
+			u.User = url.UserPassword(cfg.User, password)
+		}
+	}
+
+	query := url.Values{}
+	for key, value := range cfg.Params {
+		query.Set(key, value)
+	}
+
+	if cfg.SSLMode != "" {
+		query.Set("sslmode", cfg.SSLMode)
+	}
+
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+func (cfg *Config) mysqlDSN(password string) (string, error) {
+	dsn := mysqldriver.NewConfig()
+	dsn.User = cfg.User
+	dsn.Passwd = password
+	dsn.Net = "tcp"
+	dsn.Addr = cfg.hostPort(3306)
+	dsn.DBName = cfg.Database
+
+	// the tracker scans created_at into time.Time
+	dsn.ParseTime = true
+
+	switch cfg.SSLMode {
+	case "", "disable":
+	case "require":
+		dsn.TLSConfig = "skip-verify"
+	case "verify-ca", "verify-full":
+		dsn.TLSConfig = "true"
+	default:
+		return "", fmt.Errorf("unsupported sslmode for mysql: %s", cfg.SSLMode)
+	}
+
+	// known settings such as parseTime are parsed so they land in the right field
+	if len(cfg.Params) > 0 {
+		parsed, err := mysqldriver.ParseDSN(dsn.FormatDSN() + "&" + encodeParams(cfg.Params))
+		if err != nil {
+			return "", fmt.Errorf("params: %w", err)
+		}
+
+		dsn = parsed
+	}
+
+	return dsn.FormatDSN(), nil
+}
+
+func (cfg *Config) sqliteDSN() string {
+	if len(cfg.Params) == 0 {
+		return cfg.Database
+	}
+
+	return cfg.Database + "?" + encodeParams(cfg.Params)
+}
+
+// encodeParams joins params in key order so the DSN is stable
+func encodeParams(params map[string]string) string {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, key := range keys {
+		parts = append(parts, url.QueryEscape(key)+"="+url.QueryEscape(params[key]))
+	}
+
+	return strings.Join(parts, "&")
+}
@@ -0,0 +1,23 @@
+package src
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrPendingMigrations is returned when migrations are waiting to be applied
+var ErrPendingMigrations = errors.New("pending migrations")
+
+// MigrationError is returned when a migration fails, later migrations are not run
+type MigrationError struct {
+	File string
+	Err  error
+}
+
+func (e *MigrationError) Error() string {
+	return fmt.Sprintf("migration %s failed: %v", e.File, e.Err)
+}
+
+func (e *MigrationError) Unwrap() error {
+	return e.Err
+}
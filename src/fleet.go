@@ -0,0 +1,193 @@
+package src
+
+import (
+	"context"
+	"fmt"
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/sagar290/migo/common"
+	"io/fs"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Shard is one database of a fleet, as listed under shards: in the config
+type Shard struct {
+	// Name identifies the shard in reports, the host and database of its DSN
+	Name string
+	// DBType is the dialect, read from the DSN scheme or db_type
+	DBType string
+	DSN    string
+}
+
+// ShardResult is the outcome of migrating one shard
+type ShardResult struct {
+	Shard    Shard
+	Err      error
+	Skipped  bool
+	Duration time.Duration
+}
+
+// ShardStatus is the migration status of one shard, Err is set when it could not be read
+type ShardStatus struct {
+	Shard    Shard
+	Statuses []MigrationStatus
+	Err      error
+}
+
+// Shards resolves the shards: list. A postgres:// or postgresql:// DSN is a Postgres shard,
+// a mysql:// prefix marks a MySQL shard and is dropped, anything else is of db_type.
+func (cfg *Config) Shards() ([]Shard, error) {
+
+	if len(cfg.ShardDSNs) == 0 {
+		return nil, fmt.Errorf("no shards configured: list their DSNs under shards:")
+	}
+
+	shards := make([]Shard, 0, len(cfg.ShardDSNs))
+	seen := map[string]bool{}
+
+	for i, dsn := range cfg.ShardDSNs {
+		shard := Shard{DBType: cfg.DBType, DSN: dsn}
+
+		lower := strings.ToLower(dsn)
+		switch {
+		case strings.HasPrefix(lower, "postgres://"), strings.HasPrefix(lower, "postgresql://"):
+			shard.DBType = "postgres"
+		case strings.HasPrefix(lower, "mysql://"):
+			shard.DBType = "mysql"
+			shard.DSN = dsn[len("mysql://"):]
+		}
+
+		if shard.DBType == "sqlite" {
+			return nil, fmt.Errorf("shard %d: sqlite shards are not supported", i+1)
+		}
+
+		shard.Name = shardName(shard, i)
+		if seen[shard.Name] {
+			shard.Name = fmt.Sprintf("%s#%d", shard.Name, i+1)
+		}
+		seen[shard.Name] = true
+
+		shards = append(shards, shard)
+	}
+
+	return shards, nil
+}
+
+// shardName is host/database of the DSN, so reports never show a password
+func shardName(shard Shard, index int) string {
+
+	if strings.Contains(shard.DSN, "://") {
+		if u, err := url.Parse(shard.DSN); err == nil && u.Host != "" {
+			return u.Host + u.Path
+		}
+	}
+
+	if shard.DBType == "mysql" {
+		if parsed, err := mysqldriver.ParseDSN(shard.DSN); err == nil && parsed.Addr != "" {
+			return parsed.Addr + "/" + parsed.DBName
+		}
+	}
+
+	return fmt.Sprintf("shard-%d", index+1)
+}
+
+// Fleet runs migrations against every shard of the config, each over a connection of its own
+type Fleet struct {
+	Config *Config
+	Source fs.FS
+}
+
+// NewFleet reads the migrations through the tracker's source, it connects to nothing until used
+func NewFleet(cfg *Config, tracker *Tracker) *Fleet {
+	return &Fleet{
+		Config: cfg,
+		Source: migrationSource(cfg, tracker),
+	}
+}
+
+// Up runs Up against every shard, at most shard_parallelism at a time. After the
+// first failure no further shards are started; the ones already running finish and the
+// rest are reported as skipped.
+func (f *Fleet) Up(ctx context.Context) ([]ShardResult, error) {
+
+	shards, err := f.Config.Shards()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]ShardResult, len(shards))
+	dry, _ := ctx.Value(common.DryRunKey).(bool)
+
+	// one shard at a time is a canary rollout
+	errs, skipped := runEach(ctx, len(shards), f.Config.ShardParallelism, true, func(i int) error {
+		started := time.Now()
+		err := f.withShard(shards[i], !dry, func(runner Migrator) error {
+			return runner.Up(ctx)
+		})
+		results[i].Duration = time.Since(started)
+
+		return err
+	})
+
+	failures, skips := 0, 0
+	for i := range results {
+		results[i].Shard = shards[i]
+		results[i].Err = errs[i]
+		results[i].Skipped = skipped[i]
+
+		if errs[i] != nil {
+			failures++
+		}
+
+		if skipped[i] {
+			skips++
+		}
+	}
+
+	if failures > 0 {
+		return results, fmt.Errorf("%d of %d shard(s) failed, %d skipped", failures, len(results), skips)
+	}
+
+	return results, nil
+}
+
+// Status reads the migration status of every shard, a shard that cannot be
+// reached is reported with its error instead of failing the whole fleet
+func (f *Fleet) Status(ctx context.Context) ([]ShardStatus, error) {
+
+	shards, err := f.Config.Shards()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]ShardStatus, len(shards))
+
+	errs, _ := runEach(ctx, len(shards), f.Config.ShardParallelism, false, func(i int) error {
+		return f.withShard(shards[i], false, func(runner Migrator) error {
+			var err error
+			statuses[i].Statuses, err = runner.Status(ctx)
+
+			return err
+		})
+	})
+
+	for i := range statuses {
+		statuses[i].Shard = shards[i]
+		statuses[i].Err = errs[i]
+	}
+
+	return statuses, nil
+}
+
+// withShard opens a runner of its own on a shard and closes its connection afterwards,
+// ensure creates the migrations table first
+func (f *Fleet) withShard(shard Shard, ensure bool, run func(runner Migrator) error) error {
+
+	cfg := *f.Config
+	cfg.DBType = shard.DBType
+	cfg.DBURL = shard.DSN
+	cfg.ShardDSNs = nil
+
+	return withConnection(&cfg, shard.DBType, shard.DSN, f.Source, ensure, run)
+}
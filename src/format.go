@@ -0,0 +1,199 @@
+package src
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"sync"
+)
+
+// FileFormat is a single-file migration layout, the tracker picks the first format whose
+// Detect accepts a file. Paired NNN_name.up.sql / NNN_name.down.sql files are handled by the
+// tracker itself since they span two files.
+type FileFormat interface {
+	Name() string
+	// Detect reports whether content is written in this format
+	Detect(content []byte) bool
+	// Locate returns the up or down block, Line is where its first line sits in the file
+	Locate(content []byte, up bool) Block
+}
+
+// Suffixes of the paired layout, both halves are tracked under NNN_name.sql
+const (
+	UpFileSuffix   = ".up.sql"
+	DownFileSuffix = ".down.sql"
+)
+
+var (
+	formatsMu   sync.Mutex
+	fileFormats = []FileFormat{AnnotationFormat{}}
+)
+
+// RegisterFileFormat adds a layout, it is tried before the built-in ones
+func RegisterFileFormat(format FileFormat) {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+
+	fileFormats = append([]FileFormat{format}, fileFormats...)
+}
+
+// DetectFileFormat returns the layout of a migration file, [UP]/[DOWN] tags when nothing else matches
+func DetectFileFormat(content []byte) FileFormat {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+
+	for _, format := range fileFormats {
+		if format.Detect(content) {
+			return format
+		}
+	}
+
+	return TagFormat{}
+}
+
+// TagFormat is the original layout with whole-line [UP]...[/UP] and [DOWN]...[/DOWN] tags
+type TagFormat struct{}
+
+func (TagFormat) Name() string {
+	return "tags"
+}
+
+func (TagFormat) Detect(content []byte) bool {
+	return hasLine(content, func(line string) bool {
+		return line == "[UP]" || line == "[DOWN]"
+	})
+}
+
+func (TagFormat) Locate(content []byte, up bool) Block {
+	if up {
+		return scanBlock(content, "[UP]", "[/UP]", "[DOWN]")
+	}
+
+	return scanBlock(content, "[DOWN]", "[/DOWN]", "[UP]")
+}
+
+// Comment annotations of AnnotationFormat
+const (
+	UpAnnotation   = "-- migo:up"
+	DownAnnotation = "-- migo:down"
+)
+
+// AnnotationFormat marks blocks with "-- migo:up" and "-- migo:down" comments, so the file
+// stays valid SQL. A block runs until the other annotation or the end of the file.
+type AnnotationFormat struct{}
+
+func (AnnotationFormat) Name() string {
+	return "annotations"
+}
+
+func (AnnotationFormat) Detect(content []byte) bool {
+	return hasLine(content, func(line string) bool {
+		return isAnnotation(line, UpAnnotation) || isAnnotation(line, DownAnnotation)
+	})
+}
+
+func (AnnotationFormat) Locate(content []byte, up bool) Block {
+	var out bytes.Buffer
+
+	open, other := UpAnnotation, DownAnnotation
+	if !up {
+		open, other = DownAnnotation, UpAnnotation
+	}
+
+	block := Block{}
+	insideBlock := false
+	lineNumber := 0
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmedLine := strings.TrimSpace(line)
+		lineNumber++
+
+		switch {
+		case isAnnotation(trimmedLine, open):
+			insideBlock = true
+			if block.Line == 0 {
+				block.Line = lineNumber + 1
+			}
+		case isAnnotation(trimmedLine, other):
+			insideBlock = false
+		default:
+			if insideBlock {
+				out.WriteString(line + "\n")
+			}
+		}
+	}
+
+	block.SQL = out.String()
+
+	return block
+}
+
+// isAnnotation matches an annotation case-insensitively, ignoring extra spaces after "--"
+func isAnnotation(line, annotation string) bool {
+	return strings.EqualFold(strings.Join(strings.Fields(line), " "), annotation)
+}
+
+// IsPairedFile reports whether a file is one half of a NNN_name.up.sql / NNN_name.down.sql pair
+func IsPairedFile(name string) bool {
+	return strings.HasSuffix(name, UpFileSuffix) || strings.HasSuffix(name, DownFileSuffix)
+}
+
+// pairedKey is the name both halves of a pair are tracked under
+func pairedKey(name string) string {
+	key := MigrationKey(name)
+	key = strings.TrimSuffix(key, UpFileSuffix)
+	key = strings.TrimSuffix(key, DownFileSuffix)
+
+	return key + ".sql"
+}
+
+// isBlockMarker reports whether a trimmed line opens a block in any built-in format
+func isBlockMarker(line string) bool {
+	return line == "[UP]" || line == "[DOWN]" || isAnnotation(line, UpAnnotation) || isAnnotation(line, DownAnnotation)
+}
+
+func hasLine(content []byte, match func(line string) bool) bool {
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		if match(strings.TrimSpace(scanner.Text())) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func scanBlock(content []byte, openTag, closeTag, otherTag string) Block {
+	var out bytes.Buffer
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+
+	block := Block{}
+	insideBlock := false
+	lineNumber := 0
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmedLine := strings.TrimSpace(line)
+		lineNumber++
+
+		switch trimmedLine {
+		case openTag:
+			insideBlock = true
+			if block.Line == 0 {
+				block.Line = lineNumber + 1
+			}
+		case closeTag, otherTag:
+			insideBlock = false
+		default:
+			if insideBlock {
+				out.WriteString(line + "\n")
+			}
+		}
+	}
+
+	block.SQL = out.String()
+
+	return block
+}
@@ -0,0 +1,157 @@
+package src
+
+import (
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestDetectFileFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"tags", "[UP]\nCREATE TABLE a (id int);\n[/UP]\n[DOWN]\nDROP TABLE a;\n[/DOWN]\n", "tags"},
+		{"annotations", "-- migo:up\nCREATE TABLE a (id int);\n-- migo:down\nDROP TABLE a;\n", "annotations"},
+		{"annotations with odd spacing and case", "--   MIGO:UP\nSELECT 1;\n", "annotations"},
+		{"indented tags", "  [UP]\nSELECT 1;\n  [/UP]\n", "tags"},
+		{"plain SQL falls back to tags", "CREATE TABLE a (id int);\n", "tags"},
+		{"tag inside a line is not a marker", "SELECT '[UP]';\n", "tags"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectFileFormat([]byte(tt.content)).Name(); got != tt.want {
+				t.Errorf("DetectFileFormat() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocateBlocks(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   FileFormat
+		content  string
+		up       bool
+		wantSQL  string
+		wantLine int
+	}{
+		{
+			name:     "tags up",
+			format:   TagFormat{},
+			content:  "-- header\n[UP]\nCREATE TABLE a (id int);\n[/UP]\n[DOWN]\nDROP TABLE a;\n[/DOWN]\n",
+			up:       true,
+			wantSQL:  "CREATE TABLE a (id int);\n",
+			wantLine: 3,
+		},
+		{
+			name:     "tags down",
+			format:   TagFormat{},
+			content:  "[UP]\nCREATE TABLE a (id int);\n[/UP]\n[DOWN]\nDROP TABLE a;\n[/DOWN]\n",
+			up:       false,
+			wantSQL:  "DROP TABLE a;\n",
+			wantLine: 5,
+		},
+		{
+			name:     "tags without a close tag end at the other block",
+			format:   TagFormat{},
+			content:  "[UP]\nSELECT 1;\n[DOWN]\nSELECT 2;\n",
+			up:       true,
+			wantSQL:  "SELECT 1;\n",
+			wantLine: 2,
+		},
+		{
+			name:     "tags with no down block",
+			format:   TagFormat{},
+			content:  "[UP]\nSELECT 1;\n[/UP]\n",
+			up:       false,
+			wantSQL:  "",
+			wantLine: 0,
+		},
+		{
+			name:     "annotations up",
+			format:   AnnotationFormat{},
+			content:  "-- migo:no-transaction\n-- migo:up\nCREATE INDEX CONCURRENTLY i ON a (id);\n-- migo:down\nDROP INDEX i;\n",
+			up:       true,
+			wantSQL:  "CREATE INDEX CONCURRENTLY i ON a (id);\n",
+			wantLine: 3,
+		},
+		{
+			name:     "annotations down runs to the end of the file",
+			format:   AnnotationFormat{},
+			content:  "-- migo:up\nSELECT 1;\n-- migo:down\nSELECT 2;\nSELECT 3;\n",
+			up:       false,
+			wantSQL:  "SELECT 2;\nSELECT 3;\n",
+			wantLine: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			block := tt.format.Locate([]byte(tt.content), tt.up)
+
+			if block.SQL != tt.wantSQL || block.Line != tt.wantLine {
+				t.Errorf("Locate() = %q at line %d, want %q at line %d", block.SQL, block.Line, tt.wantSQL, tt.wantLine)
+			}
+		})
+	}
+}
+
+func TestPairedFiles(t *testing.T) {
+	source := fstest.MapFS{
+		"001_users.up.sql":   {Data: []byte("CREATE TABLE users (id int);\n")},
+		"001_users.down.sql": {Data: []byte("DROP TABLE users;\n")},
+		"002_index.up.sql":   {Data: []byte("CREATE INDEX i ON users (id);\n")},
+		"003_tags.sql":       {Data: []byte("[UP]\nSELECT 1;\n[/UP]\n")},
+	}
+
+	tracker := NewTrackerFS(&Config{}, source)
+	if err := tracker.ListSqlFiles(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"001_users.sql", "002_index.sql", "003_tags.sql"}
+	if got := tracker.MigrationFiles; !reflect.DeepEqual(got, want) {
+		t.Fatalf("MigrationFiles = %v, want %v", got, want)
+	}
+
+	up, err := tracker.LocateUpBlock("001_users.sql")
+	if err != nil || up.SQL != "CREATE TABLE users (id int);\n" || up.Line != 1 {
+		t.Errorf("up = %+v, %v", up, err)
+	}
+
+	down, err := tracker.LocateDownBlock("001_users.sql")
+	if err != nil || down.SQL != "DROP TABLE users;\n" {
+		t.Errorf("down = %+v, %v", down, err)
+	}
+
+	missing, err := tracker.LocateDownBlock("002_index.sql")
+	if err != nil || missing.SQL != "" {
+		t.Errorf("missing down half = %+v, %v", missing, err)
+	}
+}
+
+func TestPairedFilesNeedAnUpHalf(t *testing.T) {
+	source := fstest.MapFS{
+		"001_users.down.sql": {Data: []byte("DROP TABLE users;\n")},
+	}
+
+	if err := NewTrackerFS(&Config{}, source).ListSqlFiles(); err == nil {
+		t.Error("ListSqlFiles() accepted a down file without its up file")
+	}
+}
+
+func TestIsPairedFile(t *testing.T) {
+	for name, want := range map[string]bool{
+		"001_a.up.sql":   true,
+		"001_a.down.sql": true,
+		"001_a.sql":      false,
+		"001_up.sql":     false,
+	} {
+		if got := IsPairedFile(name); got != want {
+			t.Errorf("IsPairedFile(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package src
+
+import (
+	"context"
+	"fmt"
+	"gorm.io/gorm"
+	"path"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// GoMigrationFunc receives the connection, or the transaction when the dialect supports transactional DDL
+type GoMigrationFunc func(ctx context.Context, tx *gorm.DB) error
+
+// GoMigration is a migration written in Go, tracked as "<timestamp>_<description>.go"
+type GoMigration struct {
+	Name string
+	Up   GoMigrationFunc
+	Down GoMigrationFunc
+}
+
+var (
+	goMigrationsMu sync.Mutex
+	goMigrations   = map[string]*GoMigration{}
+)
+
+// goMigrationFile matches scaffolded Go migrations, e.g. 20240101120000_reencode_emails.go
+var goMigrationFile = regexp.MustCompile(`^\d+_\w+\.go$`)
+
+// RegisterGoMigration adds a Go migration to every tracker, usually from an init func.
+// name uses the same "<timestamp>_<description>" scheme as `migo make`.
+func RegisterGoMigration(name string, up, down GoMigrationFunc) {
+	goMigrationsMu.Lock()
+	defer goMigrationsMu.Unlock()
+
+	file := goMigrationName(name)
+	if _, exists := goMigrations[file]; exists {
+		panic(fmt.Sprintf("migo: Go migration %s registered twice", file))
+	}
+
+	goMigrations[file] = &GoMigration{Name: file, Up: up, Down: down}
+}
+
+// RegisteredGoMigrations returns the registered Go migration names in order
+func RegisteredGoMigrations() []string {
+	goMigrationsMu.Lock()
+	defer goMigrationsMu.Unlock()
+
+	names := make([]string, 0, len(goMigrations))
+	for name := range goMigrations {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+func lookupGoMigration(name string) (*GoMigration, bool) {
+	goMigrationsMu.Lock()
+	defer goMigrationsMu.Unlock()
+
+	migration, ok := goMigrations[name]
+
+	return migration, ok
+}
+
+func goMigrationName(name string) string {
+	if path.Ext(name) == ".go" {
+		return name
+	}
+
+	return name + ".go"
+}
+
+// IsGoMigration reports whether a tracked name refers to a Go migration
+func IsGoMigration(name string) bool {
+	return path.Ext(name) == ".go"
+}
@@ -0,0 +1,109 @@
+package src
+
+import (
+	"context"
+	"fmt"
+	"github.com/sagar290/migo/common"
+	"log"
+)
+
+// Goto moves the schema to version in either direction. Applied migrations newer than
+// version are rolled back newest first, pending migrations up to version are applied.
+// Version "0" rolls back everything.
+func (r *Runner) Goto(ctx context.Context, version string) error {
+
+	unlock, err := r.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	err = r.Tracker.InitTracker(ctx, r.DB)
+	if err != nil {
+		return err
+	}
+
+	if !r.knownVersion(version) {
+		return fmt.Errorf("unknown migration version %s", version)
+	}
+
+	var newer []MigoMigration
+	for _, record := range r.Tracker.GetAppliedMigrationRecords() {
+		if CompareVersions(MigrationVersion(record.Migration), version) > 0 {
+			newer = append(newer, record)
+		}
+	}
+
+	// out of order is judged against what stays applied once the newer rows are rolled back
+	kept := ""
+	for _, record := range r.Tracker.GetAppliedMigrationRecords() {
+		if v := MigrationVersion(record.Migration); CompareVersions(v, version) <= 0 && (kept == "" || CompareVersions(v, kept) > 0) {
+			kept = v
+		}
+	}
+
+	var pending, outOfOrder []string
+	for _, file := range r.Tracker.GetMigrationFiles() {
+		if CompareVersions(MigrationVersion(file), version) <= 0 {
+			pending = append(pending, file)
+
+			if kept != "" && CompareVersions(MigrationVersion(file), kept) < 0 {
+				outOfOrder = append(outOfOrder, file)
+			}
+		}
+	}
+
+	pending, err = r.outOfOrderPolicy(ctx, pending, outOfOrder, kept)
+	if err != nil {
+		return err
+	}
+
+	// going forward is an up, it refuses edited applied files the same way
+	if ignoreChecksum, _ := ctx.Value(common.IgnoreChecksumKey).(bool); len(pending) > 0 && !ignoreChecksum {
+		if err := r.checkChecksums(ctx); err != nil {
+			return err
+		}
+	}
+
+	if len(newer) == 0 && len(pending) == 0 {
+		log.Printf("🥂Already at version %s", version)
+		return nil
+	}
+
+	if len(newer) > 0 {
+		err = DownMigrationFiles(ctx, rollbackOrder(newer), r)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(pending) > 0 {
+		err = UpMigrationFiles(ctx, pending, r)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// knownVersion reports whether version belongs to a migration file or an applied row
+func (r *Runner) knownVersion(version string) bool {
+	if CompareVersions(version, "0") == 0 {
+		return true
+	}
+
+	for _, file := range r.Tracker.GetMigrationFiles() {
+		if CompareVersions(MigrationVersion(file), version) == 0 {
+			return true
+		}
+	}
+
+	for _, file := range r.Tracker.GetAppliedMigrations() {
+		if CompareVersions(MigrationVersion(file), version) == 0 {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,86 @@
+package src
+
+import (
+	"context"
+	"github.com/sagar290/migo/common"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestGoto(t *testing.T) {
+	runner := trailRunner(t, &Config{}, fstest.MapFS{
+		"001_a.sql": trailMigration("001"),
+		"002_b.sql": trailMigration("002"),
+		"003_c.sql": trailMigration("003"),
+		"004_d.sql": trailMigration("004"),
+	})
+	ctx := context.Background()
+
+	// three batches: 001, 002 and 003, 004
+	for _, steps := range []int{1, 2, 0} {
+		if err := runner.Up(context.WithValue(ctx, common.StepsKey, steps)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	trail(t, runner)
+
+	tests := []struct {
+		version string
+		steps   []string
+		applied []string
+	}{
+		{
+			version: "004",
+			applied: []string{"001_a.sql:1", "002_b.sql:2", "003_c.sql:2", "004_d.sql:3"},
+		},
+		{
+			// across batches, newest first
+			version: "001",
+			steps:   []string{"down 004", "down 003", "down 002"},
+			applied: []string{"001_a.sql:1"},
+		},
+		{
+			version: "3",
+			steps:   []string{"up 002", "up 003"},
+			applied: []string{"001_a.sql:1", "002_b.sql:2", "003_c.sql:2"},
+		},
+		{
+			version: "0004",
+			steps:   []string{"up 004"},
+			applied: []string{"001_a.sql:1", "002_b.sql:2", "003_c.sql:2", "004_d.sql:3"},
+		},
+		{
+			version: "2",
+			steps:   []string{"down 004", "down 003"},
+			applied: []string{"001_a.sql:1", "002_b.sql:2"},
+		},
+		{
+			version: "0",
+			steps:   []string{"down 002", "down 001"},
+		},
+		{
+			version: "004",
+			steps:   []string{"up 001", "up 002", "up 003", "up 004"},
+			applied: []string{"001_a.sql:1", "002_b.sql:1", "003_c.sql:1", "004_d.sql:1"},
+		},
+	}
+
+	for _, tt := range tests {
+		if err := runner.Goto(ctx, tt.version); err != nil {
+			t.Fatalf("Goto(%q): %v", tt.version, err)
+		}
+
+		if got := trail(t, runner); !reflect.DeepEqual(got, tt.steps) {
+			t.Errorf("Goto(%q) ran %v, want %v", tt.version, got, tt.steps)
+		}
+
+		if got := appliedNames(t, runner); !reflect.DeepEqual(got, tt.applied) {
+			t.Errorf("after Goto(%q) applied = %v, want %v", tt.version, got, tt.applied)
+		}
+	}
+
+	if err := runner.Goto(ctx, "5"); err == nil {
+		t.Error("Goto to an unknown version succeeded")
+	}
+}
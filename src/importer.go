@@ -0,0 +1,482 @@
+package src
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/sagar290/migo/common"
+	"gorm.io/gorm"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Tools migo can import migrations and history from
+const (
+	ImportGoose         = "goose"
+	ImportGolangMigrate = "golang-migrate"
+	ImportLaravelSQL    = "laravel-sql"
+)
+
+type ImportOptions struct {
+	// From is one of ImportGoose, ImportGolangMigrate or ImportLaravelSQL
+	From string
+	// SourceDir holds the other tool's migration files
+	SourceDir string
+	// Table is the other tool's tracking table, empty picks the tool default
+	Table string
+}
+
+type ImportResult struct {
+	Files   []string
+	Applied []string
+}
+
+// importedMigration is one migration converted to migo's format
+type importedMigration struct {
+	// Key is the version (goose, golang-migrate) or name (Laravel) the other tool tracks it by
+	Key           string
+	Name          string
+	Up            string
+	Down          string
+	NoTransaction bool
+}
+
+var (
+	laravelName    = regexp.MustCompile(`^(\d{4})_(\d{2})_(\d{2})_(\d{6})_(.+)$`)
+	migrateFile    = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+	gooseFile      = regexp.MustCompile(`^(\d+)_(.+)\.sql$`)
+	gooseDirective = regexp.MustCompile(`^--\s*\+goose\s+(.+)$`)
+)
+
+// Import converts another tool's migration files into migo files in the migrations dir and
+// copies its tracking table into the migrations table, so an existing database shows as migrated.
+// With DryRunKey set nothing is written.
+func (r *Runner) Import(ctx context.Context, opts ImportOptions) (ImportResult, error) {
+
+	dry, _ := ctx.Value(common.DryRunKey).(bool)
+
+	var (
+		migrations []importedMigration
+		table      string
+		err        error
+	)
+
+	switch opts.From {
+	case ImportGoose:
+		table = "goose_db_version"
+		migrations, err = readGooseMigrations(opts.SourceDir, r.DB.Dialector.Name())
+	case ImportGolangMigrate:
+		table = "schema_migrations"
+		migrations, err = readGolangMigrateMigrations(opts.SourceDir)
+	case ImportLaravelSQL:
+		table = "migrations"
+		migrations, err = readLaravelMigrations(opts.SourceDir)
+	default:
+		return ImportResult{}, fmt.Errorf("unknown import source %q, use goose, golang-migrate or laravel-sql", opts.From)
+	}
+
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	if opts.Table != "" {
+		table = opts.Table
+	}
+
+	unlock, err := r.lock(ctx)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	defer unlock()
+
+	history, err := r.importHistory(ctx, opts.From, table, migrations)
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	dir := r.Config.GetMigrationDir()
+	result := ImportResult{}
+
+	for _, migration := range migrations {
+		target := filepath.Join(dir, migration.Name)
+		if _, err := os.Stat(target); err == nil {
+			return ImportResult{}, fmt.Errorf("%s already exists, refusing to overwrite it", target)
+		}
+
+		result.Files = append(result.Files, migration.Name)
+		if _, ok := history[migration.Name]; ok {
+			result.Applied = append(result.Applied, migration.Name)
+		}
+	}
+
+	if dry {
+		return result, nil
+	}
+
+	for _, migration := range migrations {
+		if err := os.WriteFile(filepath.Join(dir, migration.Name), []byte(renderMigoFile(migration)), 0644); err != nil {
+			return ImportResult{}, fmt.Errorf("write %s: %w", migration.Name, err)
+		}
+	}
+
+	err = r.Tracker.InitTracker(ctx, r.DB)
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	err = r.DB.Transaction(func(tx *gorm.DB) error {
+		for _, migration := range migrations {
+			batch, ok := history[migration.Name]
+			if !ok || contains(r.Tracker.GetAppliedMigrations(), migration.Name) {
+				continue
+			}
+
+			checksum, err := r.Tracker.Checksum(migration.Name)
+			if err != nil {
+				return err
+			}
+
+			err = tx.WithContext(ctx).Table(r.Config.TrackerTable(tx.Dialector.Name())).Create(&MigoMigration{
+				Migration: migration.Name,
+				Batch:     r.Tracker.GetLastBatch() + batch,
+				Checksum:  checksum,
+			}).Error
+			if err != nil {
+				return fmt.Errorf("add migration %s: %w", migration.Name, err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	return result, nil
+}
+
+// importHistory reads the other tool's tracking table into migo file name -> batch, batches start at 1
+func (r *Runner) importHistory(ctx context.Context, from string, table string, migrations []importedMigration) (map[string]int, error) {
+
+	history := map[string]int{}
+
+	if !r.DB.Migrator().HasTable(table) {
+		log.Printf("⚠️ Tracking table %s not found, importing files only", table)
+		return history, nil
+	}
+
+	conn := r.DB.WithContext(ctx)
+
+	switch from {
+	case ImportGoose:
+		var rows []struct {
+			VersionID int64
+			IsApplied bool
+		}
+
+		err := conn.Raw(fmt.Sprintf(`SELECT version_id, is_applied FROM %s ORDER BY id`, table)).Scan(&rows).Error
+		if err != nil {
+			return nil, err
+		}
+
+		// goose appends a row per up and down, the latest row of a version wins
+		applied := map[int64]bool{}
+		for _, row := range rows {
+			applied[row.VersionID] = row.IsApplied
+		}
+
+		for _, migration := range migrations {
+			for version, ok := range applied {
+				if ok && version != 0 && CompareVersions(migration.Key, fmt.Sprint(version)) == 0 {
+					history[migration.Name] = 1
+				}
+			}
+		}
+
+	case ImportGolangMigrate:
+		var rows []struct {
+			Version int64
+			Dirty   bool
+		}
+
+		err := conn.Raw(fmt.Sprintf(`SELECT version, dirty FROM %s`, table)).Scan(&rows).Error
+		if err != nil {
+			return nil, err
+		}
+
+		if len(rows) == 0 {
+			return history, nil
+		}
+
+		if rows[0].Dirty {
+			return nil, fmt.Errorf("%s is dirty at version %d, fix it with golang-migrate before importing", table, rows[0].Version)
+		}
+
+		// golang-migrate only stores the current version, everything up to it is applied
+		for _, migration := range migrations {
+			if CompareVersions(migration.Key, fmt.Sprint(rows[0].Version)) <= 0 {
+				history[migration.Name] = 1
+			}
+		}
+
+	case ImportLaravelSQL:
+		var rows []struct {
+			Migration string
+			Batch     int
+		}
+
+		err := conn.Raw(fmt.Sprintf(`SELECT migration, batch FROM %s`, table)).Scan(&rows).Error
+		if err != nil {
+			return nil, err
+		}
+
+		batches := map[string]int{}
+		for _, row := range rows {
+			batches[row.Migration] = row.Batch
+		}
+
+		for _, migration := range migrations {
+			if batch, ok := batches[migration.Key]; ok {
+				history[migration.Name] = batch
+			}
+		}
+	}
+
+	return history, nil
+}
+
+// gooseDelimiter ends a StatementBegin/StatementEnd body on MySQL
+const gooseDelimiter = "//"
+
+// readGooseMigrations converts "-- +goose Up/Down" annotated files
+func readGooseMigrations(dir string, dialect string) ([]importedMigration, error) {
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []importedMigration
+
+	for _, entry := range entries {
+		match := gooseFile.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			if strings.HasSuffix(entry.Name(), ".go") {
+				log.Printf("⚠️ Skipping Go migration %s, port it with 'migo make --go'", entry.Name())
+			}
+			continue
+		}
+
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migration := importedMigration{Key: match[1]}
+
+		var up, down strings.Builder
+		var current *strings.Builder
+		// bodyStart is where the open StatementBegin body starts in current, -1 outside one
+		bodyStart := -1
+
+		scanner := bufio.NewScanner(strings.NewReader(string(content)))
+		for scanner.Scan() {
+			line := scanner.Text()
+
+			directive := gooseDirective.FindStringSubmatch(strings.TrimSpace(line))
+			if directive == nil {
+				if current != nil {
+					current.WriteString(line + "\n")
+				}
+				continue
+			}
+
+			switch strings.ToUpper(strings.TrimSpace(directive[1])) {
+			case "UP":
+				current, bodyStart = &up, -1
+			case "DOWN":
+				current, bodyStart = &down, -1
+			case "NO TRANSACTION":
+				migration.NoTransaction = true
+
+			// StatementBegin/StatementEnd wrap a body with semicolons inside. The splitter keeps
+			// Postgres dollar-quoted and BEGIN ATOMIC bodies and SQLite triggers together on its
+			// own, a MySQL procedure or trigger needs a DELIMITER block.
+			case "STATEMENTBEGIN":
+				if current != nil && dialect == "mysql" {
+					current.WriteString("DELIMITER " + gooseDelimiter + "\n")
+					bodyStart = current.Len()
+				}
+			case "STATEMENTEND":
+				if current != nil && bodyStart >= 0 {
+					text := current.String()
+					body := strings.TrimSuffix(strings.TrimRight(text[bodyStart:], " \t\r\n"), ";")
+
+					current.Reset()
+					current.WriteString(text[:bodyStart] + body + "\n" + gooseDelimiter + "\nDELIMITER ;\n")
+					bodyStart = -1
+				}
+			}
+		}
+
+		migration.Up = up.String()
+		migration.Down = down.String()
+		migration.Name = match[1] + "_" + match[2]
+
+		migrations = append(migrations, migration)
+	}
+
+	return padVersions(migrations), nil
+}
+
+// readGolangMigrateMigrations joins NNN_name.up.sql and NNN_name.down.sql pairs
+func readGolangMigrateMigrations(dir string) ([]importedMigration, error) {
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := map[string]*importedMigration{}
+
+	for _, entry := range entries {
+		match := migrateFile.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		name := match[1] + "_" + match[2]
+		migration, ok := byName[name]
+		if !ok {
+			migration = &importedMigration{Key: match[1], Name: name}
+			byName[name] = migration
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	var migrations []importedMigration
+	for _, migration := range byName {
+		migrations = append(migrations, *migration)
+	}
+
+	return padVersions(migrations), nil
+}
+
+// readLaravelMigrations converts SQL exports of Laravel migrations named
+// 2024_01_01_120000_create_users_table(.up|.down).sql, a file without suffix is the up block
+func readLaravelMigrations(dir string) ([]importedMigration, error) {
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := map[string]*importedMigration{}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+
+		base := strings.TrimSuffix(entry.Name(), ".sql")
+		direction := "up"
+		switch {
+		case strings.HasSuffix(base, ".up"):
+			base = strings.TrimSuffix(base, ".up")
+		case strings.HasSuffix(base, ".down"):
+			base = strings.TrimSuffix(base, ".down")
+			direction = "down"
+		}
+
+		match := laravelName.FindStringSubmatch(base)
+		if match == nil {
+			continue
+		}
+
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byName[base]
+		if !ok {
+			migration = &importedMigration{
+				Key:  base,
+				Name: match[1] + match[2] + match[3] + match[4] + "_" + match[5],
+			}
+			byName[base] = migration
+		}
+
+		if direction == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	var migrations []importedMigration
+	for _, migration := range byName {
+		migration.Name += ".sql"
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Name < migrations[j].Name
+	})
+
+	return migrations, nil
+}
+
+// padVersions zero-pads numeric versions to one width so files sort in version order,
+// and appends the .sql extension
+func padVersions(migrations []importedMigration) []importedMigration {
+
+	width := 0
+	for _, migration := range migrations {
+		if version := MigrationVersion(migration.Name); len(version) > width {
+			width = len(version)
+		}
+	}
+
+	for i, migration := range migrations {
+		version := MigrationVersion(migration.Name)
+		rest := strings.TrimPrefix(migration.Name, version)
+		migrations[i].Name = strings.Repeat("0", width-len(version)) + version + rest + ".sql"
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Name < migrations[j].Name
+	})
+
+	return migrations
+}
+
+func renderMigoFile(migration importedMigration) string {
+	var out strings.Builder
+
+	if migration.NoTransaction {
+		out.WriteString(NoTransactionDirective + "\n")
+	}
+
+	out.WriteString("[UP]\n")
+	out.WriteString(strings.TrimSpace(migration.Up) + "\n")
+	out.WriteString("[/UP]\n\n[DOWN]\n")
+	out.WriteString(strings.TrimSpace(migration.Down) + "\n")
+	out.WriteString("[/DOWN]\n")
+
+	return out.String()
+}
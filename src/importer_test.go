@@ -0,0 +1,56 @@
+package src
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadGooseMigrationsMySQLProcedure(t *testing.T) {
+	migrations, err := readGooseMigrations("testdata/goose", "mysql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(migrations) != 2 {
+		t.Fatalf("got %d migrations, want 2", len(migrations))
+	}
+
+	procedure := migrations[1]
+	if procedure.Name != "00002_order_total_procedure.sql" {
+		t.Errorf("name = %q", procedure.Name)
+	}
+
+	var got []string
+	for _, statement := range SplitStatements(procedure.Up, "mysql") {
+		got = append(got, statement.SQL)
+	}
+
+	want := []string{
+		"CREATE PROCEDURE order_total(IN order_id INT, OUT result DECIMAL(10, 2))\n" +
+			"BEGIN\n" +
+			"    SELECT total INTO result FROM orders WHERE id = order_id;\n" +
+			"    SET result = COALESCE(result, 0);\n" +
+			"END",
+		"INSERT INTO orders (id, total) VALUES (1, 9.99)",
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("statements = %q, want %q", got, want)
+	}
+
+	if down := SplitStatements(procedure.Down, "mysql"); len(down) != 1 || down[0].SQL != "DROP PROCEDURE order_total" {
+		t.Errorf("down = %+v", down)
+	}
+}
+
+func TestReadGooseMigrationsKeepsBodyOnPostgres(t *testing.T) {
+	migrations, err := readGooseMigrations("testdata/goose", "postgres")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if up := migrations[1].Up; strings.Contains(up, "DELIMITER") {
+		t.Errorf("postgres body got a DELIMITER block:\n%s", up)
+	}
+}
@@ -0,0 +1,335 @@
+package src
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"hash/crc32"
+	"os"
+	"time"
+)
+
+// ErrLockTimeout is returned when another process keeps the migration lock past the wait timeout
+var ErrLockTimeout = errors.New("timed out waiting for migration lock")
+
+const lockPollInterval = 500 * time.Millisecond
+
+// unlockTimeout bounds the unlock query, which runs even when the caller's context is done
+const unlockTimeout = 10 * time.Second
+
+// LockStatus describes who holds the migration lock, Since is only known on SQLite
+type LockStatus struct {
+	Locked bool
+	Owner  string
+	Since  time.Time
+}
+
+// NewLocker picks the lock implementation for the connection dialect
+func NewLocker(conn *gorm.DB, cfg *Config) (Locker, error) {
+	name := "migo:" + cfg.GetMigrationTable()
+	if cfg.Schema != "" {
+		// tenant schemas each have a migrations table and must not wait on each other
+		name = "migo:" + cfg.Schema + "." + cfg.GetMigrationTable()
+	}
+
+	switch conn.Dialector.Name() {
+	case "postgres":
+		return &PostgresLocker{db: conn, key: int64(crc32.ChecksumIEEE([]byte(name))), timeout: cfg.GetLockTimeout()}, nil
+	case "mysql":
+		return &MysqlLocker{db: conn, name: name, timeout: cfg.GetLockTimeout()}, nil
+	case "sqlite":
+		return &SqliteLocker{db: conn, table: cfg.GetMigrationTable() + "_lock", timeout: cfg.GetLockTimeout()}, nil
+	default:
+		return nil, fmt.Errorf("unsupported dialect for locking: %s", conn.Dialector.Name())
+	}
+}
+
+// dedicatedConn pins a pool connection, session level locks must be released on the same session
+func dedicatedConn(ctx context.Context, conn *gorm.DB) (*sql.Conn, error) {
+	sqlDB, err := conn.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	return sqlDB.Conn(ctx)
+}
+
+// pollLock calls try until it succeeds, fails or the timeout passes
+func pollLock(ctx context.Context, timeout time.Duration, try func() (bool, error)) error {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		ok, err := try()
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%w after %s", ErrLockTimeout, timeout)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// PostgresLocker uses a session level advisory lock
+type PostgresLocker struct {
+	db      *gorm.DB
+	key     int64
+	timeout time.Duration
+	conn    *sql.Conn
+}
+
+func (l *PostgresLocker) Lock(ctx context.Context) error {
+	conn, err := dedicatedConn(ctx, l.db)
+	if err != nil {
+		return err
+	}
+
+	err = pollLock(ctx, l.timeout, func() (bool, error) {
+		var ok bool
+		err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, l.key).Scan(&ok)
+		return ok, err
+	})
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	l.conn = conn
+
+	return nil
+}
+
+func (l *PostgresLocker) Unlock(ctx context.Context) error {
+	if l.conn == nil {
+		return nil
+	}
+
+	defer func() { l.conn = nil }()
+
+	return releaseSessionLock(ctx, l.conn, `SELECT pg_advisory_unlock($1)`, l.key)
+}
+
+func (l *PostgresLocker) Status(ctx context.Context) (LockStatus, error) {
+	var pids []int
+
+	// a bigint advisory key is split into classid (high bits) and objid (low bits)
+	err := l.db.WithContext(ctx).Raw(`
+		SELECT pid
+		FROM pg_locks
+		WHERE locktype = 'advisory'
+		  AND classid = ?
+		  AND objid = ?
+		  AND objsubid = 1
+		  AND granted
+	`, uint32(l.key>>32), uint32(l.key)).Scan(&pids).Error
+	if err != nil {
+		return LockStatus{}, err
+	}
+
+	if len(pids) == 0 {
+		return LockStatus{}, nil
+	}
+
+	return LockStatus{Locked: true, Owner: fmt.Sprintf("pid %d", pids[0])}, nil
+}
+
+// ForceUnlock terminates the backend holding the advisory lock
+func (l *PostgresLocker) ForceUnlock(ctx context.Context) error {
+	return l.db.WithContext(ctx).Exec(`
+		SELECT pg_terminate_backend(pid)
+		FROM pg_locks
+		WHERE locktype = 'advisory'
+		  AND classid = ?
+		  AND objid = ?
+		  AND objsubid = 1
+		  AND granted
+	`, uint32(l.key>>32), uint32(l.key)).Error
+}
+
+// MysqlLocker uses a named lock from GET_LOCK
+type MysqlLocker struct {
+	db      *gorm.DB
+	name    string
+	timeout time.Duration
+	conn    *sql.Conn
+}
+
+func (l *MysqlLocker) Lock(ctx context.Context) error {
+	conn, err := dedicatedConn(ctx, l.db)
+	if err != nil {
+		return err
+	}
+
+	var ok sql.NullInt64
+	err = conn.QueryRowContext(ctx, `SELECT GET_LOCK(?, ?)`, l.name, int(l.timeout.Seconds())).Scan(&ok)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	if !ok.Valid || ok.Int64 != 1 {
+		conn.Close()
+		return fmt.Errorf("%w after %s", ErrLockTimeout, l.timeout)
+	}
+
+	l.conn = conn
+
+	return nil
+}
+
+func (l *MysqlLocker) Unlock(ctx context.Context) error {
+	if l.conn == nil {
+		return nil
+	}
+
+	defer func() { l.conn = nil }()
+
+	return releaseSessionLock(ctx, l.conn, `SELECT RELEASE_LOCK(?)`, l.name)
+}
+
+func (l *MysqlLocker) Status(ctx context.Context) (LockStatus, error) {
+	var holder sql.NullInt64
+
+	err := l.db.WithContext(ctx).Raw(`SELECT IS_USED_LOCK(?)`, l.name).Row().Scan(&holder)
+	if err != nil {
+		return LockStatus{}, err
+	}
+
+	if !holder.Valid {
+		return LockStatus{}, nil
+	}
+
+	return LockStatus{Locked: true, Owner: fmt.Sprintf("connection %d", holder.Int64)}, nil
+}
+
+// ForceUnlock kills the connection holding the named lock
+func (l *MysqlLocker) ForceUnlock(ctx context.Context) error {
+	var holder sql.NullInt64
+
+	err := l.db.WithContext(ctx).Raw(`SELECT IS_USED_LOCK(?)`, l.name).Row().Scan(&holder)
+	if err != nil || !holder.Valid {
+		return err
+	}
+
+	return l.db.WithContext(ctx).Exec(fmt.Sprintf("KILL %d", holder.Int64)).Error
+}
+
+// SqliteLocker keeps a single lock row in a side table, SQLite has no session locks
+type SqliteLocker struct {
+	db      *gorm.DB
+	table   string
+	timeout time.Duration
+	owner   string
+}
+
+func (l *SqliteLocker) ensureTable(ctx context.Context) error {
+	return l.db.WithContext(ctx).Exec(fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS "%s" (
+			id INTEGER PRIMARY KEY,
+			owner TEXT NOT NULL,
+			locked_at DATETIME NOT NULL
+		)
+	`, l.table)).Error
+}
+
+func (l *SqliteLocker) Lock(ctx context.Context) error {
+	if err := l.ensureTable(ctx); err != nil {
+		return err
+	}
+
+	hostname, _ := os.Hostname()
+	owner := fmt.Sprintf("%s:%d", hostname, os.Getpid())
+
+	err := pollLock(ctx, l.timeout, func() (bool, error) {
+		result := l.db.WithContext(ctx).Exec(
+			fmt.Sprintf(`INSERT OR IGNORE INTO "%s" (id, owner, locked_at) VALUES (1, ?, ?)`, l.table),
+			owner, time.Now(),
+		)
+
+		return result.RowsAffected == 1, result.Error
+	})
+	if err != nil {
+		return err
+	}
+
+	l.owner = owner
+
+	return nil
+}
+
+func (l *SqliteLocker) Unlock(ctx context.Context) error {
+	if l.owner == "" {
+		return nil
+	}
+
+	defer func() {
+		l.owner = ""
+	}()
+
+	return l.db.WithContext(ctx).Exec(fmt.Sprintf(`DELETE FROM "%s" WHERE id = 1 AND owner = ?`, l.table), l.owner).Error
+}
+
+func (l *SqliteLocker) Status(ctx context.Context) (LockStatus, error) {
+	if err := l.ensureTable(ctx); err != nil {
+		return LockStatus{}, err
+	}
+
+	var rows []struct {
+		Owner    string
+		LockedAt time.Time
+	}
+
+	err := l.db.WithContext(ctx).Raw(fmt.Sprintf(`SELECT owner, locked_at FROM "%s" WHERE id = 1`, l.table)).Scan(&rows).Error
+	if err != nil {
+		return LockStatus{}, err
+	}
+
+	if len(rows) == 0 {
+		return LockStatus{}, nil
+	}
+
+	return LockStatus{Locked: true, Owner: rows[0].Owner, Since: rows[0].LockedAt}, nil
+}
+
+// ForceUnlock removes the lock row whoever owns it
+func (l *SqliteLocker) ForceUnlock(ctx context.Context) error {
+	if err := l.ensureTable(ctx); err != nil {
+		return err
+	}
+
+	return l.db.WithContext(ctx).Exec(fmt.Sprintf(`DELETE FROM "%s" WHERE id = 1`, l.table)).Error
+}
+
+// releaseSessionLock runs the unlock query on the connection holding a session lock and
+// returns it to the pool. The query ignores cancellation of ctx, so a cancelled run still
+// unlocks; when it fails anyway the connection is discarded, closing the session and the
+// lock with it, instead of pooling a session that still holds the lock.
+func releaseSessionLock(ctx context.Context, conn *sql.Conn, query string, args ...any) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), unlockTimeout)
+	defer cancel()
+
+	_, err := conn.ExecContext(ctx, query, args...)
+	if err != nil {
+		// ErrBadConn from Raw makes database/sql close the connection rather than reuse it
+		_ = conn.Raw(func(any) error { return driver.ErrBadConn })
+	}
+
+	if closeErr := conn.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
@@ -0,0 +1,75 @@
+package src
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSqliteLocker(t *testing.T) {
+	conn, err := openDB("sqlite", filepath.Join(t.TempDir(), "lock.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if sqlDB, err := conn.DB(); err == nil {
+			sqlDB.Close()
+		}
+	}()
+
+	cfg := &Config{LockTimeout: 100 * time.Millisecond}
+	ctx := context.Background()
+
+	first, err := NewLocker(conn, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewLocker(conn, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := first.Lock(ctx); err != nil {
+		t.Fatalf("first Lock: %v", err)
+	}
+
+	status, err := second.Status(ctx)
+	if err != nil || !status.Locked || status.Owner == "" || status.Since.IsZero() {
+		t.Errorf("Status = %+v, %v, want locked with an owner", status, err)
+	}
+
+	started := time.Now()
+	if err := second.Lock(ctx); !errors.Is(err, ErrLockTimeout) {
+		t.Fatalf("second Lock = %v, want ErrLockTimeout", err)
+	}
+	if waited := time.Since(started); waited < cfg.LockTimeout {
+		t.Errorf("second Lock gave up after %s, want at least %s", waited, cfg.LockTimeout)
+	}
+
+	// unlocking a lock it never took leaves the holder alone
+	if err := second.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := first.Status(ctx); !status.Locked {
+		t.Error("second Unlock released the first locker's lock")
+	}
+
+	if err := second.ForceUnlock(ctx); err != nil {
+		t.Fatalf("ForceUnlock: %v", err)
+	}
+	if status, err := first.Status(ctx); err != nil || status.Locked {
+		t.Errorf("Status after ForceUnlock = %+v, %v, want unlocked", status, err)
+	}
+
+	if err := second.Lock(ctx); err != nil {
+		t.Fatalf("Lock after ForceUnlock: %v", err)
+	}
+	if err := second.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := second.Status(ctx); status.Locked {
+		t.Error("lock still held after Unlock")
+	}
+}
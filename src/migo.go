@@ -2,133 +2,222 @@ package src
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/sagar290/migo/common"
 	"gorm.io/driver/mysql"
 	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"log"
+	"sort"
 	"strings"
 	"time"
 )
 
-var db *gorm.DB
-
 type Runner struct {
 	Config  *Config
 	Tracker MigrationTracker
+	Locker  Locker
+	DB      *gorm.DB
 }
 
 type MigoMigration struct {
-	ID        uint      `gorm:"primaryKey;autoIncrement"`
-	Migration string    `gorm:"type:varchar(255);not null;uniqueIndex"`
-	Batch     int       `gorm:"not null;default:1"`
-	CreatedAt time.Time `gorm:"autoCreateTime"`
+	ID           uint      `gorm:"primaryKey;autoIncrement"`
+	Migration    string    `gorm:"type:varchar(255);not null;uniqueIndex"`
+	Batch        int       `gorm:"not null;default:1"`
+	Checksum     string    `gorm:"type:varchar(64);not null;default:''"`
+	Irreversible bool      `gorm:"not null;default:false"`
+	CreatedAt    time.Time `gorm:"autoCreateTime"`
 }
 
-func EnsureMigrationTable(db *gorm.DB) error {
-	return db.AutoMigrate(&MigoMigration{})
+// MigrationStatus describes a single migration and whether it has been applied.
+// OutOfOrder marks pending migrations older than the newest applied one, Missing marks
+// applied migrations whose file is gone. Directives come from the file header.
+type MigrationStatus struct {
+	Migration    string
+	Applied      bool
+	Batch        int
+	AppliedAt    time.Time
+	OutOfOrder   bool
+	Missing      bool
+	Irreversible bool
+	Directives   Directives
 }
 
+// NewMigo opens a connection from Config.DBType and Config.DSN
 func NewMigo(cfg *Config, tracker *Tracker) (Migrator, error) {
 
-	var err error
-
-	switch cfg.DBType {
-	case "postgres":
-		db, err = gorm.Open(postgres.Open(cfg.DBURL), &gorm.Config{})
-	case "mysql":
-		db, err = gorm.Open(mysql.Open(cfg.DBURL), &gorm.Config{})
-	case "sqlite":
-		db, err = gorm.Open(sqlite.Open(cfg.DBURL), &gorm.Config{})
-	default:
-		return nil, fmt.Errorf("unsupported DB type: %s", cfg.DBType)
+	if !cfg.HasConnection() {
+		return nil, fmt.Errorf("no database configured: set db_url or host/database, or pass --fleet to run against shards")
 	}
 
+	dsn, err := cfg.DSN()
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("build DSN: %w", err)
 	}
 
-	err = EnsureMigrationTable(db)
+	conn, err := connect(cfg, cfg.DBType, dsn)
 	if err != nil {
-		log.Panicln("failed to create migration table:", err)
+		return nil, err
 	}
 
-	return &Runner{
-		Config:  cfg,
-		Tracker: tracker,
-	}, nil
+	return NewMigoWithDB(cfg, conn, tracker)
 }
 
-// Up migrate table
-func (r *Runner) Up(ctx context.Context) error {
+// openDB opens a gorm connection for a dialect name, every pooled connection runs the
+// session statements before it is used
+func openDB(dbType string, dsn string, session ...string) (*gorm.DB, error) {
 
-	steps, _ := ctx.Value(common.StepsKey).(int)
+	if len(session) > 0 {
+		sqlDB, err := openSessionDB(dbType, dsn, session)
+		if err != nil {
+			return nil, err
+		}
 
-	err := r.Tracker.InitTracker(ctx, db)
-	if err != nil {
-		return err
+		return openSQLDB(dbType, sqlDB)
 	}
 
-	files := r.Tracker.GetMigrationFiles()
+	var dialector gorm.Dialector
 
-	// if steps provided limit the files
-	if steps > 0 && steps < len(files) {
-		files = files[:steps]
+	switch dbType {
+	case "postgres":
+		dialector = postgres.Open(dsn)
+	case "mysql":
+		dialector = mysql.Open(dsn)
+	case "sqlite":
+		dialector = sqlite.Open(dsn)
+	default:
+		return nil, fmt.Errorf("unsupported DB type: %s", dbType)
 	}
 
-	err = UpMigrationFiles(ctx, files, r)
+	return gorm.Open(dialector, &gorm.Config{})
+}
+
+// NewMigoWithSQLDB runs migrations over an existing *sql.DB, Config.DBType picks the dialect
+func NewMigoWithSQLDB(cfg *Config, sqlDB *sql.DB, tracker *Tracker) (Migrator, error) {
+
+	conn, err := openSQLDB(cfg.DBType, sqlDB)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return NewMigoWithDB(cfg, conn, tracker)
 }
 
-// Rollback migration according to the batch id
-func (r *Runner) Rollback(ctx context.Context) error {
+func openSQLDB(dbType string, sqlDB *sql.DB) (*gorm.DB, error) {
 
-	steps, _ := ctx.Value(common.StepsKey).(int)
+	var dialector gorm.Dialector
 
-	err := r.Tracker.InitTracker(ctx, db)
-	if err != nil {
-		return err
+	switch dbType {
+	case "postgres":
+		dialector = postgres.New(postgres.Config{Conn: sqlDB})
+	case "mysql":
+		dialector = mysql.New(mysql.Config{Conn: sqlDB})
+	case "sqlite":
+		dialector = sqlite.New(sqlite.Config{Conn: sqlDB})
+	default:
+		return nil, fmt.Errorf("unsupported DB type: %s", dbType)
 	}
 
-	lastBatchId := r.Tracker.GetLastBatch()
+	return gorm.Open(dialector, &gorm.Config{})
+}
 
-	appliedFiles := r.Tracker.GetAppliedMigrationFileByBatchId(lastBatchId)
+// NewMigoWithDB runs migrations over an existing *gorm.DB. The connection stays on the
+// runner, so several runners can work against different databases in one process.
+// The migrations table is created in Config.Schema; the search_path or default database,
+// role and session_init of the connection are left as the caller opened it.
+func NewMigoWithDB(cfg *Config, conn *gorm.DB, tracker *Tracker) (Migrator, error) {
 
-	// if steps provided limit the files
-	if steps > 0 && steps < len(appliedFiles) {
-		appliedFiles = appliedFiles[(len(appliedFiles) - steps):]
+	err := EnsureMigrationTable(conn, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("create migration table: %w", err)
 	}
 
-	err = DownMigrationFiles(ctx, appliedFiles, r)
+	return newRunner(cfg, conn, tracker)
+}
 
+// newRunner wraps a connection without creating the schema or the migrations table, for
+// dry runs and status reads that must leave the database as it is
+func newRunner(cfg *Config, conn *gorm.DB, tracker *Tracker) (*Runner, error) {
+
+	locker, err := NewLocker(conn, cfg)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return &Runner{
+		Config:  cfg,
+		Tracker: tracker,
+		Locker:  locker,
+		DB:      conn,
+	}, nil
+}
+
+// lock takes the migration lock and returns the func that releases it, dry runs don't lock
+func (r *Runner) lock(ctx context.Context) (func(), error) {
+	dry, _ := ctx.Value(common.DryRunKey).(bool)
+	if dry {
+		return func() {}, nil
+	}
+
+	if err := r.Locker.Lock(ctx); err != nil {
+		return nil, fmt.Errorf("acquire migration lock: %w", err)
+	}
+
+	return func() {
+		if err := r.Locker.Unlock(ctx); err != nil {
+			log.Printf("⚠️ Failed to release migration lock: %v", err)
+		}
+	}, nil
+}
+
+// LockStatus reports who currently holds the migration lock
+func (r *Runner) LockStatus(ctx context.Context) (LockStatus, error) {
+	return r.Locker.Status(ctx)
+}
+
+// ForceUnlock clears a lock left behind by a crashed or stuck process
+func (r *Runner) ForceUnlock(ctx context.Context) error {
+	return r.Locker.ForceUnlock(ctx)
 }
 
-// Refresh rollback all table and run migrate
-func (r *Runner) Refresh(ctx context.Context) error {
+// Up migrate table
+func (r *Runner) Up(ctx context.Context) error {
+
+	steps, _ := ctx.Value(common.StepsKey).(int)
+	ignoreChecksum, _ := ctx.Value(common.IgnoreChecksumKey).(bool)
+
+	unlock, err := r.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
-	err := r.Tracker.InitTracker(ctx, db)
+	err = r.Tracker.InitTracker(ctx, r.DB)
 	if err != nil {
 		return err
 	}
 
-	appliedFiles := r.Tracker.GetAppliedMigrations()
-	err = DownMigrationFiles(ctx, appliedFiles, r)
+	if !ignoreChecksum {
+		if err := r.checkChecksums(ctx); err != nil {
+			return err
+		}
+	}
+
+	files, err := r.applyOutOfOrderPolicy(ctx, r.Tracker.GetMigrationFiles())
 	if err != nil {
 		return err
 	}
 
-	err = UpMigrationFiles(ctx, appliedFiles, r)
+	// if steps provided limit the files
+	if steps > 0 && steps < len(files) {
+		files = files[:steps]
+	}
+
+	err = UpMigrationFiles(ctx, files, r)
 	if err != nil {
 		return err
 	}
@@ -139,19 +228,34 @@ func (r *Runner) Refresh(ctx context.Context) error {
 // Fresh drop all table and run migrate
 func (r *Runner) Fresh(ctx context.Context) error {
 
-	err := DropTableByDialect(r.Config.GetSchemaName(), r.Config.GetMigrationTable())
+	unlock, err := r.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	err = DropTableByDialect(r.DB, r.Config.GetSchemaName(), r.Config.GetMigrationTable())
 	if err != nil {
 		return err
 	}
 
 	// fresh the migration table
-	query := fmt.Sprintf(`TRUNCATE TABLE %s RESTART IDENTITY CASCADE`, r.Config.GetMigrationTable())
-	err = db.Exec(query).Error
+	table := clause.Table{Name: r.Config.TrackerTable(r.DB.Dialector.Name())}
+
+	switch r.DB.Dialector.Name() {
+	case "postgres":
+		err = r.DB.Exec(`TRUNCATE TABLE ? RESTART IDENTITY CASCADE`, table).Error
+	case "mysql":
+		err = r.DB.Exec(`TRUNCATE TABLE ?`, table).Error
+	default:
+		// sqlite has no TRUNCATE
+		err = r.DB.Exec(`DELETE FROM ?`, table).Error
+	}
 	if err != nil {
-		log.Fatalf("Failed to truncate table: %v", err)
+		return fmt.Errorf("truncate migration table: %w", err)
 	}
 
-	err = r.Tracker.InitTracker(ctx, db)
+	err = r.Tracker.InitTracker(ctx, r.DB)
 	if err != nil {
 		return err
 	}
@@ -166,18 +270,18 @@ func (r *Runner) Fresh(ctx context.Context) error {
 	return nil
 }
 
-func DropTableByDialect(schemaName, migrationsTable string) error {
+func DropTableByDialect(conn *gorm.DB, schemaName, migrationsTable string) error {
 	var tables []struct {
 		Schema string
 		Name   string
 	}
 
-	switch db.Dialector.Name() {
+	switch conn.Dialector.Name() {
 
 	// -------------------- PostgreSQL (also covers CockroachDB under "postgres") --------------------
 	case "postgres":
 		// list base tables in a schema (skip views), exclude migrations table
-		if err := db.Raw(`
+		if err := conn.Raw(`
 			SELECT table_schema AS schema, table_name AS name
 			FROM information_schema.tables
 			WHERE table_type = 'BASE TABLE'
@@ -190,7 +294,7 @@ func DropTableByDialect(schemaName, migrationsTable string) error {
 		for _, t := range tables {
 			qualified := fmt.Sprintf(`%q.%q`, t.Schema, t.Name)
 			q := fmt.Sprintf(`DROP TABLE IF EXISTS %s CASCADE`, qualified)
-			if err := db.Exec(q).Error; err != nil {
+			if err := conn.Exec(q).Error; err != nil {
 				log.Printf("❌ Failed to drop %s: %v", qualified, err)
 			} else {
 				log.Printf("⛔️ Dropped %s", qualified)
@@ -200,53 +304,55 @@ func DropTableByDialect(schemaName, migrationsTable string) error {
 	// -------------------- MySQL / MariaDB --------------------
 	case "mysql":
 		// disable FK checks so drop order doesn't matter
-		if err := db.Exec(`SET FOREIGN_KEY_CHECKS = 0`).Error; err != nil {
+		if err := conn.Exec(`SET FOREIGN_KEY_CHECKS = 0`).Error; err != nil {
 			return err
 		}
-		defer db.Exec(`SET FOREIGN_KEY_CHECKS = 1`)
+		defer conn.Exec(`SET FOREIGN_KEY_CHECKS = 1`)
 
-		// schemaName here is the database name
-		if err := db.Raw(`
-			SELECT table_schema AS schema, table_name AS name
+		// the schema is the connected database, schemaName would default to public
+		if err := conn.Raw(`
+			SELECT table_name AS name
 			FROM information_schema.tables
-			WHERE table_schema = ?
+			WHERE table_schema = DATABASE()
 			  AND table_type = 'BASE TABLE'
 			  AND table_name <> ?
-		`, schemaName, migrationsTable).Scan(&tables).Error; err != nil {
+		`, migrationsTable).Scan(&tables).Error; err != nil {
 			return err
 		}
 
 		for _, t := range tables {
-			q := fmt.Sprintf("DROP TABLE IF EXISTS `%s`.`%s`", schemaName, t.Name)
-			if err := db.Exec(q).Error; err != nil {
-				log.Printf("❌ Failed to drop %s.%s: %v", schemaName, t.Name, err)
+			q := fmt.Sprintf("DROP TABLE IF EXISTS `%s`", t.Name)
+			if err := conn.Exec(q).Error; err != nil {
+				log.Printf("❌ Failed to drop %s: %v", t.Name, err)
 			} else {
-				log.Printf("⛔️ Dropped %s.%s", schemaName, t.Name)
+				log.Printf("⛔️ Dropped %s", t.Name)
 			}
 		}
 
 	// -------------------- SQLite --------------------
 	case "sqlite":
 		// turn off FKs to avoid dependency errors
-		if err := db.Exec(`PRAGMA foreign_keys = OFF`).Error; err != nil {
+		if err := conn.Exec(`PRAGMA foreign_keys = OFF`).Error; err != nil {
 			return err
 		}
-		defer db.Exec(`PRAGMA foreign_keys = ON`)
+		defer conn.Exec(`PRAGMA foreign_keys = ON`)
 
 		// schemaName is ignored in SQLite; it’s a single-file DB
-		if err := db.Raw(`
+		// the lock table is kept as well, Fresh is holding the lock while it runs
+		if err := conn.Raw(`
 			SELECT name AS name
 			FROM sqlite_master
 			WHERE type = 'table'
+			  AND name <> ?
 			  AND name <> ?
 			  AND name NOT LIKE 'sqlite_%'
-		`, migrationsTable).Scan(&tables).Error; err != nil {
+		`, migrationsTable, migrationsTable+"_lock").Scan(&tables).Error; err != nil {
 			return err
 		}
 
 		for _, t := range tables {
 			q := fmt.Sprintf(`DROP TABLE IF EXISTS "%s"`, t.Name)
-			if err := db.Exec(q).Error; err != nil {
+			if err := conn.Exec(q).Error; err != nil {
 				log.Printf("❌ Failed to drop %s: %v", t.Name, err)
 			} else {
 				log.Printf("⛔️Dropped %s", t.Name)
@@ -257,7 +363,7 @@ func DropTableByDialect(schemaName, migrationsTable string) error {
 	case "sqlserver":
 		// Default schema is usually dbo; pass via schemaName.
 		// Gather base tables for the schema (exclude views & migrations table)
-		if err := db.Raw(`
+		if err := conn.Raw(`
 			SELECT TABLE_SCHEMA AS schema, TABLE_NAME AS name
 			FROM INFORMATION_SCHEMA.TABLES
 			WHERE TABLE_TYPE = 'BASE TABLE'
@@ -272,14 +378,14 @@ func DropTableByDialect(schemaName, migrationsTable string) error {
 			qualified := fmt.Sprintf(`[%s].[%s]`, t.Schema, t.Name)
 
 			// Disable all constraints to avoid FK issues
-			if err := db.Exec(fmt.Sprintf(`ALTER TABLE %s NOCHECK CONSTRAINT ALL`, qualified)).Error; err != nil {
+			if err := conn.Exec(fmt.Sprintf(`ALTER TABLE %s NOCHECK CONSTRAINT ALL`, qualified)).Error; err != nil {
 				// not fatal; try to drop anyway
 				log.Printf("⚠️  Could not disable constraints on %s: %v", qualified, err)
 			}
 
 			// SQL Server 2016+ supports DROP TABLE IF EXISTS
 			drop := fmt.Sprintf(`DROP TABLE IF EXISTS %s`, qualified)
-			if err := db.Exec(drop).Error; err != nil {
+			if err := conn.Exec(drop).Error; err != nil {
 				log.Printf("❌ Failed to drop %s: %v", qualified, err)
 			} else {
 				log.Printf("⛔️ Dropped %s", qualified)
@@ -287,19 +393,74 @@ func DropTableByDialect(schemaName, migrationsTable string) error {
 		}
 
 	default:
-		return fmt.Errorf("unsupported dialect: %s", db.Dialector.Name())
+		return fmt.Errorf("unsupported dialect: %s", conn.Dialector.Name())
 	}
 
 	return nil
 }
 
-// Status shows all applied migrations
-func (r *Runner) Status(ctx context.Context) ([]MigoMigration, error) {
-	return nil, nil
+// Status lists every known migration with its applied or pending state
+func (r *Runner) Status(ctx context.Context) ([]MigrationStatus, error) {
+
+	err := r.Tracker.InitTracker(ctx, r.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []MigrationStatus
+
+	missing := map[string]bool{}
+	for _, file := range r.Tracker.GetOrphanedMigrations() {
+		missing[file] = true
+	}
+
+	for _, record := range r.Tracker.GetAppliedMigrationRecords() {
+		statuses = append(statuses, MigrationStatus{
+			Migration:    record.Migration,
+			Applied:      true,
+			Batch:        record.Batch,
+			AppliedAt:    record.CreatedAt,
+			Missing:      missing[record.Migration],
+			Irreversible: record.Irreversible,
+		})
+	}
+
+	outOfOrder := map[string]bool{}
+	for _, file := range r.Tracker.GetOutOfOrderMigrations() {
+		outOfOrder[file] = true
+	}
+
+	for _, file := range r.Tracker.GetMigrationFiles() {
+		statuses = append(statuses, MigrationStatus{
+			Migration:  file,
+			OutOfOrder: outOfOrder[file],
+		})
+	}
+
+	sort.SliceStable(statuses, func(i, j int) bool {
+		return statuses[i].Migration < statuses[j].Migration
+	})
+
+	for i, status := range statuses {
+		if status.Missing {
+			continue
+		}
+
+		statuses[i].Directives, err = r.Tracker.Directives(status.Migration)
+		if err != nil {
+			return nil, err
+		}
+
+		statuses[i].Irreversible = statuses[i].Irreversible || statuses[i].Directives.Irreversible
+	}
+
+	return statuses, nil
 }
 
 func UpMigrationFiles(ctx context.Context, files []string, r *Runner) error {
 	dry, _ := ctx.Value(common.DryRunKey).(bool)
+	single, _ := ctx.Value(common.SingleTransactionKey).(bool)
+
 	if len(files) == 0 {
 		log.Printf("🥂Nothing to migrate......")
 		return nil
@@ -307,69 +468,280 @@ func UpMigrationFiles(ctx context.Context, files []string, r *Runner) error {
 
 	if dry {
 		fmt.Printf("🔎 Dry run — %d migration(s) would run:\n", len(files))
+		r.printSession()
 	}
 
+	if single && !dry {
+		if err := checkSingleTransaction(files, r); err != nil {
+			return err
+		}
+
+		return r.DB.Transaction(func(tx *gorm.DB) error {
+			return upMigrationFiles(ctx, files, r, tx, true)
+		})
+	}
+
+	return upMigrationFiles(ctx, files, r, r.DB, false)
+}
+
+func upMigrationFiles(ctx context.Context, files []string, r *Runner, conn *gorm.DB, single bool) error {
+	dry, _ := ctx.Value(common.DryRunKey).(bool)
+	continueOnError, _ := ctx.Value(common.ContinueOnErrorKey).(bool)
+
+	var failed []error
+
 	for i, file := range files {
-		queryText, err := r.Tracker.ExtractUpBlock(file)
+		preview, run, err := r.migrationStep(ctx, file, true)
 		if err != nil {
 			return err
 		}
 
-		if strings.TrimSpace(queryText) == "" {
+		if run == nil {
 			log.Println("⚠️ Skipping empty or no-up-block:", file)
 			continue
 		}
 
 		if dry {
-			fmt.Printf("  %2d) %s\n", i+1, queryText)
+			fmt.Printf("  %2d) %s\n", i+1, preview)
 			continue
 		}
 
-		if err := db.Exec(queryText).Error; err != nil {
-			log.Printf("❌ Failed to execute %s: %v\n", file, err)
-			continue
+		directives, err := r.Tracker.Directives(file)
+		if err != nil {
+			return err
 		}
 
-		err = r.Tracker.AddMigrationInfo(ctx, db, file)
+		transactional := useTransaction(conn, directives, single)
+
+		err = execWithDirectives(ctx, conn, file, directives, transactional, run, func(tx *gorm.DB) error {
+			return r.Tracker.AddMigrationInfo(ctx, tx, file)
+		})
 		if err != nil {
-			return err
+			if single || !continueOnError {
+				return &MigrationError{File: file, Err: err}
+			}
+
+			log.Printf("❌ Failed to execute %s: %v\n", file, err)
+			failed = append(failed, &MigrationError{File: file, Err: err})
+
+			continue
 		}
 
 		log.Printf("✅ %s", file)
 	}
-	return nil
+
+	// with --continue-on-error every failure is reported once the run is done
+	return errors.Join(failed...)
 }
 
 func DownMigrationFiles(ctx context.Context, appliedFiles []string, r *Runner) error {
 	dry, _ := ctx.Value(common.DryRunKey).(bool)
+	single, _ := ctx.Value(common.SingleTransactionKey).(bool)
+
+	if err := checkReversible(appliedFiles, r); err != nil {
+		return err
+	}
+
+	if dry && len(appliedFiles) > 0 {
+		fmt.Printf("🔎 Dry run — %d migration(s) would be rolled back:\n", len(appliedFiles))
+		r.printSession()
+	}
+
+	if single && !dry {
+		if err := checkSingleTransaction(appliedFiles, r); err != nil {
+			return err
+		}
+
+		return r.DB.Transaction(func(tx *gorm.DB) error {
+			return downMigrationFiles(ctx, appliedFiles, r, tx, true)
+		})
+	}
+
+	return downMigrationFiles(ctx, appliedFiles, r, r.DB, false)
+}
+
+func downMigrationFiles(ctx context.Context, appliedFiles []string, r *Runner, conn *gorm.DB, single bool) error {
+	dry, _ := ctx.Value(common.DryRunKey).(bool)
+	continueOnError, _ := ctx.Value(common.ContinueOnErrorKey).(bool)
+
+	var failed []error
 
 	for i, file := range appliedFiles {
-		queryText, err := r.Tracker.ExtractDownBlock(file)
+		preview, run, err := r.migrationStep(ctx, file, false)
 		if err != nil {
 			return err
 		}
 
-		if strings.TrimSpace(queryText) == "" {
+		if run == nil {
 			log.Println("⚠️ Skipping empty or no-down-block:", file)
 			continue
 		}
 
 		if dry {
-			fmt.Printf("  %2d) %s\n", i+1, queryText)
+			fmt.Printf("  %2d) %s\n", i+1, preview)
 			continue
 		}
 
-		if err := db.Exec(queryText).Error; err != nil {
+		directives, err := r.Tracker.Directives(file)
+		if err != nil {
+			return err
+		}
+
+		transactional := useTransaction(conn, directives, single)
+
+		err = execWithDirectives(ctx, conn, file, directives, transactional, run, func(tx *gorm.DB) error {
+			return r.Tracker.RemoveMigrationInfo(ctx, tx, file)
+		})
+		if err != nil {
+			if single || !continueOnError {
+				return &MigrationError{File: file, Err: err}
+			}
+
 			log.Printf("❌ Failed to execute %s: %v\n", file, err)
+			failed = append(failed, &MigrationError{File: file, Err: err})
 			continue
 		}
 
-		err = r.Tracker.RemoveMigrationInfo(ctx, db, file)
+		log.Printf("⛔️%s", file)
+	}
+
+	// with --continue-on-error every failure is reported once the run is done
+	return errors.Join(failed...)
+}
+
+// SupportsTransactionalDDL reports whether schema changes can be rolled back on this dialect
+func SupportsTransactionalDDL(conn *gorm.DB) bool {
+	switch conn.Dialector.Name() {
+	case "postgres", "sqlite":
+		return true
+	default:
+		return false
+	}
+}
+
+// useTransaction decides whether a single file gets its own transaction.
+// Inside a single-transaction run the outer transaction already covers it.
+func useTransaction(conn *gorm.DB, directives Directives, single bool) bool {
+	if single || !SupportsTransactionalDDL(conn) {
+		return false
+	}
+
+	return !directives.NoTransaction
+}
+
+// checkSingleTransaction makes sure a whole batch can be wrapped in one transaction
+func checkSingleTransaction(files []string, r *Runner) error {
+	if !SupportsTransactionalDDL(r.DB) {
+		return fmt.Errorf("--single-transaction is not supported on %s: DDL is not transactional", r.DB.Dialector.Name())
+	}
+
+	for _, file := range files {
+		transactional, err := r.Tracker.UseTransaction(file)
 		if err != nil {
 			return err
 		}
 
-		log.Printf("⛔️%s", file)
+		if !transactional {
+			return fmt.Errorf("--single-transaction cannot run %s: it opts out with %s", file, NoTransactionDirective)
+		}
+	}
+
+	return nil
+}
+
+// migrationStep returns what a dry run prints and the func that runs one direction of a
+// migration, run is nil when there is nothing to do
+func (r *Runner) migrationStep(ctx context.Context, file string, up bool) (string, func(tx *gorm.DB) error, error) {
+
+	if IsGoMigration(file) {
+		migration, ok := r.Tracker.GetGoMigration(file)
+		if !ok {
+			return "", nil, fmt.Errorf("Go migration %s is not registered in this binary", file)
+		}
+
+		fn := migration.Down
+		if up {
+			fn = migration.Up
+		}
+
+		if fn == nil {
+			return "", nil, nil
+		}
+
+		return fmt.Sprintf("%s (Go migration)", file), func(tx *gorm.DB) error {
+			return fn(tx.Statement.Context, tx)
+		}, nil
+	}
+
+	locate := r.Tracker.LocateDownBlock
+	if up {
+		locate = r.Tracker.LocateUpBlock
+	}
+
+	block, err := locate(file)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if strings.TrimSpace(block.SQL) == "" {
+		return "", nil, nil
 	}
+
+	directives, err := r.Tracker.Directives(file)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if !directives.NoTemplate && strings.Contains(block.SQL, "{{") {
+		data, err := r.templateData()
+		if err != nil {
+			return "", nil, err
+		}
+
+		block.SQL, err = RenderSQL(file, block.SQL, data)
+		if err != nil {
+			return "", nil, fmt.Errorf("%s: %w", file, err)
+		}
+	}
+
+	statements := SplitStatements(block.SQL, r.DB.Dialector.Name())
+
+	return block.SQL, func(tx *gorm.DB) error {
+		return execStatements(tx, block, statements)
+	}, nil
+}
+
+// execStatements runs statements one by one so a failure points at its line in the file
+func execStatements(tx *gorm.DB, block Block, statements []Statement) error {
+	for i, statement := range statements {
+		if err := tx.Exec(statement.SQL).Error; err != nil {
+			return &StatementError{
+				File:      block.File,
+				Statement: i + 1,
+				Line:      block.Line + statement.Line - 1,
+				Err:       err,
+			}
+		}
+	}
+
 	return nil
 }
+
+// execMigration runs the migration and its tracker update, in one transaction when transactional is set
+func execMigration(conn *gorm.DB, transactional bool, run func(tx *gorm.DB) error, track func(tx *gorm.DB) error) error {
+	if !transactional {
+		if err := run(conn); err != nil {
+			return err
+		}
+
+		return track(conn)
+	}
+
+	return conn.Transaction(func(tx *gorm.DB) error {
+		if err := run(tx); err != nil {
+			return err
+		}
+
+		return track(tx)
+	})
+}
@@ -0,0 +1,187 @@
+package src
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/sagar290/migo/common"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// sqliteRunner migrates a throwaway sqlite database with the files of source, the map can
+// be edited between runs
+func sqliteRunner(t *testing.T, cfg *Config, source fstest.MapFS) *Runner {
+	t.Helper()
+
+	cfg.DBType = "sqlite"
+	if cfg.Database == "" {
+		cfg.Database = filepath.Join(t.TempDir(), "migo.db")
+	}
+
+	migrator, err := NewMigo(cfg, NewTrackerFS(cfg, source))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runner := migrator.(*Runner)
+	t.Cleanup(func() {
+		if sqlDB, err := runner.DB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	return runner
+}
+
+// migrationFile is a tagged migration file with the given blocks
+func migrationFile(up string, down string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte("[UP]\n" + up + "\n[/UP]\n[DOWN]\n" + down + "\n[/DOWN]\n")}
+}
+
+// appliedRecords reads the migrations table in the order the rows were added
+func appliedRecords(t *testing.T, r *Runner) []MigoMigration {
+	t.Helper()
+
+	var records []MigoMigration
+	if err := r.DB.Table(r.Config.GetMigrationTable()).Order("id").Find(&records).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	return records
+}
+
+// appliedNames lists the migrations table as name:batch
+func appliedNames(t *testing.T, r *Runner) []string {
+	t.Helper()
+
+	var names []string
+	for _, record := range appliedRecords(t, r) {
+		names = append(names, fmt.Sprintf("%s:%d", record.Migration, record.Batch))
+	}
+
+	return names
+}
+
+// trailMigration records its up and down runs in the trail table, see trail
+func trailMigration(name string) *fstest.MapFile {
+	return migrationFile(
+		fmt.Sprintf("INSERT INTO trail (step) VALUES ('up %s');", name),
+		fmt.Sprintf("INSERT INTO trail (step) VALUES ('down %s');", name),
+	)
+}
+
+// trailRunner is a sqliteRunner with a trail table outside of any migration
+func trailRunner(t *testing.T, cfg *Config, source fstest.MapFS) *Runner {
+	t.Helper()
+
+	runner := sqliteRunner(t, cfg, source)
+	if err := runner.DB.Exec(`CREATE TABLE trail (id INTEGER PRIMARY KEY, step TEXT)`).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	return runner
+}
+
+// trail returns the steps trail migrations ran since the last call, in order
+func trail(t *testing.T, r *Runner) []string {
+	t.Helper()
+
+	var steps []string
+	if err := r.DB.Raw(`SELECT step FROM trail ORDER BY id`).Scan(&steps).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := r.DB.Exec(`DELETE FROM trail`).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	return steps
+}
+
+func TestFreshSQLite(t *testing.T) {
+	cfg := &Config{}
+
+	runner := sqliteRunner(t, cfg, fstest.MapFS{
+		"001_create_users.sql": migrationFile("CREATE TABLE users (id INTEGER PRIMARY KEY);", "DROP TABLE users;"),
+		"002_create_posts.sql": migrationFile("CREATE TABLE posts (id INTEGER PRIMARY KEY);", "DROP TABLE posts;"),
+	})
+
+	ctx := context.Background()
+
+	if err := runner.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// a table no migration knows about, and a row that must not survive
+	if err := runner.DB.Exec(`CREATE TABLE stray (id INTEGER)`).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := runner.DB.Exec(`INSERT INTO users (id) VALUES (1)`).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runner.Fresh(ctx); err != nil {
+		t.Fatalf("Fresh: %v", err)
+	}
+
+	if runner.DB.Migrator().HasTable("stray") {
+		t.Error("stray table survived fresh")
+	}
+
+	var users int64
+	if err := runner.DB.Table("users").Count(&users).Error; err != nil || users != 0 {
+		t.Errorf("users = %d, %v, want an empty table", users, err)
+	}
+
+	records := appliedRecords(t, runner)
+	if len(records) != 2 || records[0].Migration != "001_create_users.sql" || records[1].Migration != "002_create_posts.sql" {
+		t.Fatalf("migrations table = %+v", records)
+	}
+
+	for _, record := range records {
+		if record.Batch != 1 {
+			t.Errorf("%s batch = %d, want 1", record.Migration, record.Batch)
+		}
+	}
+}
+
+func TestUpContinueOnError(t *testing.T) {
+	source := fstest.MapFS{
+		"001_a.sql": migrationFile("CREATE TABLE a (id INTEGER);", "DROP TABLE a;"),
+		"002_b.sql": migrationFile("BROKEN;", ""),
+		"003_c.sql": migrationFile("CREATE TABLE c (id INTEGER);", "DROP TABLE c;"),
+	}
+	runner := sqliteRunner(t, &Config{}, source)
+	ctx := context.Background()
+
+	if err := runner.Up(ctx); err == nil {
+		t.Fatal("Up applied a broken migration")
+	}
+	if got := appliedNames(t, runner); !reflect.DeepEqual(got, []string{"001_a.sql:1"}) {
+		t.Fatalf("applied without --continue-on-error = %v", got)
+	}
+
+	// the default refuse policy doesn't stop the flag from going past the failure
+	continueOnError := context.WithValue(ctx, common.ContinueOnErrorKey, true)
+	if err := runner.Up(continueOnError); err == nil || !strings.Contains(err.Error(), "002_b.sql") {
+		t.Fatalf("Up --continue-on-error = %v, want the failure of 002_b.sql reported", err)
+	}
+	if got := appliedNames(t, runner); !reflect.DeepEqual(got, []string{"001_a.sql:1", "003_c.sql:2"}) {
+		t.Fatalf("applied with --continue-on-error = %v", got)
+	}
+
+	source["002_b.sql"] = migrationFile("CREATE TABLE b (id INTEGER);", "DROP TABLE b;")
+
+	if err := runner.Up(ctx); !errors.Is(err, ErrOutOfOrder) {
+		t.Fatalf("Up after the fix = %v, want ErrOutOfOrder", err)
+	}
+	if err := runner.Up(continueOnError); err != nil {
+		t.Fatalf("Up --continue-on-error after the fix: %v", err)
+	}
+	if got := appliedNames(t, runner); !reflect.DeepEqual(got, []string{"001_a.sql:1", "003_c.sql:2", "002_b.sql:3"}) {
+		t.Errorf("applied = %v", got)
+	}
+}
@@ -0,0 +1,88 @@
+package src
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/sagar290/migo/common"
+	"log"
+	"strings"
+)
+
+// Out-of-order policies, picked with `out_of_order` in the config
+const (
+	OutOfOrderRefuse = "refuse"
+	OutOfOrderWarn   = "warn"
+	OutOfOrderAllow  = "allow"
+)
+
+// ErrOutOfOrder is returned when pending migrations are older than the newest applied one
+var ErrOutOfOrder = errors.New("pending migrations are older than the newest applied migration")
+
+// GetOutOfOrderMigrations returns pending files whose version sorts before the newest applied migration
+func (t *Tracker) GetOutOfOrderMigrations() []string {
+
+	newest := t.GetNewestAppliedVersion()
+	if newest == "" {
+		return nil
+	}
+
+	var files []string
+	for _, file := range t.MigrationFiles {
+		if CompareVersions(MigrationVersion(file), newest) < 0 {
+			files = append(files, file)
+		}
+	}
+
+	return files
+}
+
+// GetNewestAppliedVersion returns the highest applied version, empty when nothing is applied
+func (t *Tracker) GetNewestAppliedVersion() string {
+
+	newest := ""
+	for name := range t.AppliedMigrations {
+		version := MigrationVersion(name)
+		if newest == "" || CompareVersions(version, newest) > 0 {
+			newest = version
+		}
+	}
+
+	return newest
+}
+
+// applyOutOfOrderPolicy refuses out-of-order files or keeps them, with a warning under warn
+func (r *Runner) applyOutOfOrderPolicy(ctx context.Context, files []string) ([]string, error) {
+	return r.outOfOrderPolicy(ctx, files, r.Tracker.GetOutOfOrderMigrations(), r.Tracker.GetNewestAppliedVersion())
+}
+
+// outOfOrderPolicy applies the policy to the outOfOrder files among files, newest is the applied
+// version they sort before
+func (r *Runner) outOfOrderPolicy(ctx context.Context, files []string, outOfOrder []string, newest string) ([]string, error) {
+
+	if len(outOfOrder) == 0 {
+		return files, nil
+	}
+
+	policy := r.Config.GetOutOfOrderPolicy()
+
+	// --continue-on-error accepts the gaps a failed migration leaves behind, and filling them later
+	if continueOnError, _ := ctx.Value(common.ContinueOnErrorKey).(bool); continueOnError && policy == OutOfOrderRefuse {
+		policy = OutOfOrderWarn
+	}
+
+	switch policy {
+	case OutOfOrderAllow:
+		return files, nil
+	case OutOfOrderWarn:
+		log.Printf("⚠️ Applying %d migration(s) older than %s out of order: %s",
+			len(outOfOrder), newest, strings.Join(outOfOrder, ", "))
+
+		return files, nil
+	case OutOfOrderRefuse:
+		return nil, fmt.Errorf("%w (%s): %s (set out_of_order: allow or pass --continue-on-error to apply them)",
+			ErrOutOfOrder, newest, strings.Join(outOfOrder, ", "))
+	default:
+		return nil, fmt.Errorf("unknown out_of_order policy %q, use refuse, warn or allow", policy)
+	}
+}
@@ -0,0 +1,140 @@
+package src
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// outOfOrderRunner has 001 and 003 applied and 002 pending behind them
+func outOfOrderRunner(t *testing.T, policy string) *Runner {
+	t.Helper()
+
+	source := fstest.MapFS{
+		"001_a.sql": trailMigration("001"),
+		"003_c.sql": trailMigration("003"),
+	}
+	runner := trailRunner(t, &Config{OutOfOrder: policy}, source)
+
+	if err := runner.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	trail(t, runner)
+
+	source["002_b.sql"] = trailMigration("002")
+
+	return runner
+}
+
+// captureLog collects what the standard logger prints while run runs
+func captureLog(t *testing.T, run func()) string {
+	t.Helper()
+
+	output := log.Writer()
+	defer log.SetOutput(output)
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+
+	run()
+
+	return buf.String()
+}
+
+func TestOutOfOrderDetection(t *testing.T) {
+	runner := outOfOrderRunner(t, OutOfOrderRefuse)
+
+	statuses, err := runner.Status(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]bool{}
+	for _, status := range statuses {
+		got[status.Migration] = status.OutOfOrder
+	}
+
+	want := map[string]bool{"001_a.sql": false, "002_b.sql": true, "003_c.sql": false}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("out of order = %v, want %v", got, want)
+	}
+
+	if newest := runner.Tracker.GetNewestAppliedVersion(); newest != "003" {
+		t.Errorf("newest applied = %q, want 003", newest)
+	}
+	if files := runner.Tracker.GetOutOfOrderMigrations(); !reflect.DeepEqual(files, []string{"002_b.sql"}) {
+		t.Errorf("GetOutOfOrderMigrations = %v", files)
+	}
+}
+
+func TestOutOfOrderPolicies(t *testing.T) {
+	tests := []struct {
+		policy  string
+		wantErr bool
+		warns   bool
+	}{
+		{policy: OutOfOrderRefuse, wantErr: true},
+		{policy: OutOfOrderWarn, warns: true},
+		{policy: OutOfOrderAllow},
+		{policy: "sometimes", wantErr: true},
+	}
+
+	commands := []struct {
+		name string
+		run  func(r *Runner) error
+	}{
+		{"up", func(r *Runner) error { return r.Up(context.Background()) }},
+		{"goto", func(r *Runner) error { return r.Goto(context.Background(), "3") }},
+	}
+
+	for _, command := range commands {
+		for _, tt := range tests {
+			t.Run(command.name+" "+tt.policy, func(t *testing.T) {
+				runner := outOfOrderRunner(t, tt.policy)
+
+				var err error
+				output := captureLog(t, func() {
+					err = command.run(runner)
+				})
+
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+				}
+
+				if tt.policy == OutOfOrderRefuse && !errors.Is(err, ErrOutOfOrder) {
+					t.Errorf("err = %v, want ErrOutOfOrder", err)
+				}
+
+				steps := []string{"up 002"}
+				if tt.wantErr {
+					steps = nil
+				}
+				if got := trail(t, runner); !reflect.DeepEqual(got, steps) {
+					t.Errorf("ran %v, want %v", got, steps)
+				}
+
+				if warned := strings.Contains(output, "out of order: 002_b.sql"); warned != tt.warns {
+					t.Errorf("warning logged = %v, want %v:\n%s", warned, tt.warns, output)
+				}
+			})
+		}
+	}
+}
+
+func TestGotoOutOfOrderAfterRollback(t *testing.T) {
+	runner := outOfOrderRunner(t, OutOfOrderRefuse)
+
+	// once 003 is rolled back 002 is no longer behind an applied migration
+	if err := runner.Goto(context.Background(), "2"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := trail(t, runner); !reflect.DeepEqual(got, []string{"down 003", "up 002"}) {
+		t.Errorf("ran %v", got)
+	}
+}
@@ -0,0 +1,155 @@
+package src
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+)
+
+// ErrIrreversible is returned when a rollback reaches a migration marked as irreversible
+var ErrIrreversible = errors.New("migration is irreversible")
+
+// GetOrphanedMigrations returns applied migrations that no longer have a file
+func (t *Tracker) GetOrphanedMigrations() []string {
+
+	known := make(map[string]bool, len(t.AllMigrationFiles))
+	for _, file := range t.AllMigrationFiles {
+		known[file] = true
+	}
+
+	var orphans []string
+	for _, file := range t.GetAppliedMigrations() {
+		if !known[file] {
+			orphans = append(orphans, file)
+		}
+	}
+
+	return orphans
+}
+
+// IsIrreversible reports whether an applied migration was marked as irreversible,
+// either on its row or with an irreversible directive in its file
+func (t *Tracker) IsIrreversible(file string) bool {
+	if t.AppliedMigrations[file].Irreversible {
+		return true
+	}
+
+	directives, err := t.Directives(file)
+
+	return err == nil && directives.Irreversible
+}
+
+func (t *Tracker) RenameMigrationInfo(ctx context.Context, db *gorm.DB, from string, to string) error {
+
+	return t.trackerTable(db.WithContext(ctx)).Where("migration = ?", from).Update("migration", to).Error
+}
+
+func (t *Tracker) MarkIrreversible(ctx context.Context, db *gorm.DB, file string) error {
+
+	return t.trackerTable(db.WithContext(ctx)).Where("migration = ?", file).Update("irreversible", true).Error
+}
+
+// PruneMigrations deletes tracker rows of orphaned migrations, all of them when files is empty
+func (r *Runner) PruneMigrations(ctx context.Context, files []string) ([]string, error) {
+	return r.repairOrphans(ctx, files, func(file string) error {
+		return r.Tracker.RemoveMigrationInfo(ctx, r.DB, file)
+	})
+}
+
+// MarkIrreversible flags orphaned migrations so rollbacks stop at them with a clear error,
+// all of them when files is empty
+func (r *Runner) MarkIrreversible(ctx context.Context, files []string) ([]string, error) {
+	return r.repairOrphans(ctx, files, func(file string) error {
+		return r.Tracker.MarkIrreversible(ctx, r.DB, file)
+	})
+}
+
+// RenameMigration points the tracker row of an orphaned migration at its renamed file
+func (r *Runner) RenameMigration(ctx context.Context, from string, to string) error {
+
+	unlock, err := r.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	err = r.Tracker.InitTracker(ctx, r.DB)
+	if err != nil {
+		return err
+	}
+
+	if !contains(r.Tracker.GetOrphanedMigrations(), from) {
+		return fmt.Errorf("%s is not an applied migration with a missing file", from)
+	}
+
+	if !contains(r.Tracker.GetMigrationFiles(), to) {
+		return fmt.Errorf("%s is not a pending migration file", to)
+	}
+
+	return r.Tracker.RenameMigrationInfo(ctx, r.DB, from, to)
+}
+
+// repairOrphans runs fix for the selected orphaned migrations and returns the ones it touched
+func (r *Runner) repairOrphans(ctx context.Context, files []string, fix func(file string) error) ([]string, error) {
+
+	unlock, err := r.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	err = r.Tracker.InitTracker(ctx, r.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	orphans := r.Tracker.GetOrphanedMigrations()
+
+	if len(files) == 0 {
+		files = orphans
+	}
+
+	for _, file := range files {
+		if !contains(orphans, file) {
+			return nil, fmt.Errorf("%s is not an applied migration with a missing file", file)
+		}
+	}
+
+	for _, file := range files {
+		if err := fix(file); err != nil {
+			return nil, err
+		}
+	}
+
+	return files, nil
+}
+
+// checkReversible stops a rollback before it starts when it would reach an irreversible
+// migration or one whose file is gone
+func checkReversible(files []string, r *Runner) error {
+
+	orphans := r.Tracker.GetOrphanedMigrations()
+
+	for _, file := range files {
+		if r.Tracker.IsIrreversible(file) {
+			return &MigrationError{File: file, Err: ErrIrreversible}
+		}
+
+		if contains(orphans, file) {
+			return &MigrationError{File: file, Err: fmt.Errorf("migration file is missing, run 'migo repair' to prune, rename or mark it irreversible")}
+		}
+	}
+
+	return nil
+}
+
+func contains(files []string, file string) bool {
+	for _, f := range files {
+		if f == file {
+			return true
+		}
+	}
+
+	return false
+}
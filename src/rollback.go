@@ -0,0 +1,154 @@
+package src
+
+import (
+	"context"
+	"fmt"
+	"github.com/sagar290/migo/common"
+	"log"
+	"sort"
+)
+
+// Rollback undoes applied migrations, newest batch first and in reverse file order inside a batch.
+// By default it rolls back the last batch; AllKey, BatchKey (that batch and every newer one)
+// and FileKey (one named migration) widen or narrow the selection, StepsKey caps it.
+func (r *Runner) Rollback(ctx context.Context) error {
+
+	unlock, err := r.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	err = r.Tracker.InitTracker(ctx, r.DB)
+	if err != nil {
+		return err
+	}
+
+	files, err := r.rollbackSelection(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(files) == 0 {
+		log.Printf("🥂Nothing to rollback......")
+		return nil
+	}
+
+	return DownMigrationFiles(ctx, files, r)
+}
+
+// Reset rolls back every applied migration
+func (r *Runner) Reset(ctx context.Context) error {
+	return r.Rollback(context.WithValue(ctx, common.AllKey, true))
+}
+
+// Refresh rollback all table and run migrate
+func (r *Runner) Refresh(ctx context.Context) error {
+
+	unlock, err := r.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	err = r.Tracker.InitTracker(ctx, r.DB)
+	if err != nil {
+		return err
+	}
+
+	dry, _ := ctx.Value(common.DryRunKey).(bool)
+
+	// a dry run changes nothing, so the files to re-apply are worked out up front
+	files := append(r.Tracker.GetAppliedMigrations(), r.Tracker.GetMigrationFiles()...)
+	sort.Strings(files)
+
+	err = DownMigrationFiles(ctx, rollbackOrder(r.Tracker.GetAppliedMigrationRecords()), r)
+	if err != nil {
+		return err
+	}
+
+	if !dry {
+		// reload so the batch number and pending files reflect the rollback
+		err = r.Tracker.InitTracker(ctx, r.DB)
+		if err != nil {
+			return err
+		}
+
+		files = r.Tracker.GetMigrationFiles()
+	}
+
+	return UpMigrationFiles(ctx, files, r)
+}
+
+// rollbackSelection picks the applied migrations to undo, in the order they must run
+func (r *Runner) rollbackSelection(ctx context.Context) ([]string, error) {
+
+	steps, _ := ctx.Value(common.StepsKey).(int)
+	all, _ := ctx.Value(common.AllKey).(bool)
+	batch, _ := ctx.Value(common.BatchKey).(int)
+	file, _ := ctx.Value(common.FileKey).(string)
+
+	records := r.Tracker.GetAppliedMigrationRecords()
+
+	var selected []MigoMigration
+
+	switch {
+	case all:
+		selected = records
+	case file != "":
+		for _, record := range records {
+			if record.Migration == file || CompareVersions(MigrationVersion(record.Migration), file) == 0 {
+				selected = append(selected, record)
+			}
+		}
+
+		if len(selected) == 0 {
+			return nil, fmt.Errorf("migration %s is not applied", file)
+		}
+
+		if len(selected) > 1 {
+			return nil, fmt.Errorf("version %s matches %d applied migrations, pass the full name", file, len(selected))
+		}
+	case batch > 0:
+		for _, record := range records {
+			if record.Batch >= batch {
+				selected = append(selected, record)
+			}
+		}
+	default:
+		for _, record := range records {
+			if record.Batch == r.Tracker.GetLastBatch() {
+				selected = append(selected, record)
+			}
+		}
+	}
+
+	files := rollbackOrder(selected)
+
+	// if steps provided limit the files
+	if steps > 0 && steps < len(files) {
+		files = files[:steps]
+	}
+
+	return files, nil
+}
+
+// rollbackOrder sorts applied migrations newest batch first and, inside a batch, in reverse file order
+func rollbackOrder(records []MigoMigration) []string {
+	sorted := append([]MigoMigration(nil), records...)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Batch != sorted[j].Batch {
+			return sorted[i].Batch > sorted[j].Batch
+		}
+
+		return sorted[i].Migration > sorted[j].Migration
+	})
+
+	files := make([]string, 0, len(sorted))
+	for _, record := range sorted {
+		files = append(files, record.Migration)
+	}
+
+	return files
+}
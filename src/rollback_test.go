@@ -0,0 +1,146 @@
+package src
+
+import (
+	"context"
+	"github.com/sagar290/migo/common"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+// batchedRunner applies 001 and 003 in batches 1 and 2, then 002 out of order with 004
+// in batch 3, so file order and batch order disagree
+func batchedRunner(t *testing.T) *Runner {
+	t.Helper()
+
+	source := fstest.MapFS{
+		"001_a.sql": trailMigration("001"),
+		"003_c.sql": trailMigration("003"),
+	}
+	runner := trailRunner(t, &Config{OutOfOrder: OutOfOrderAllow}, source)
+	ctx := context.Background()
+
+	if err := runner.Up(context.WithValue(ctx, common.StepsKey, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := runner.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	source["002_b.sql"] = trailMigration("002")
+	source["004_d.sql"] = trailMigration("004")
+
+	if err := runner.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"001_a.sql:1", "003_c.sql:2", "002_b.sql:3", "004_d.sql:3"}
+	if got := appliedNames(t, runner); !reflect.DeepEqual(got, want) {
+		t.Fatalf("setup applied %v, want %v", got, want)
+	}
+	trail(t, runner)
+
+	return runner
+}
+
+func TestRollback(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    map[any]any
+		steps   []string
+		applied []string
+		wantErr bool
+	}{
+		{
+			name:    "last batch in reverse file order",
+			steps:   []string{"down 004", "down 002"},
+			applied: []string{"001_a.sql:1", "003_c.sql:2"},
+		},
+		{
+			name:  "all, newest batch first",
+			keys:  map[any]any{common.AllKey: true},
+			steps: []string{"down 004", "down 002", "down 003", "down 001"},
+		},
+		{
+			name:    "batch includes itself and newer",
+			keys:    map[any]any{common.BatchKey: 2},
+			steps:   []string{"down 004", "down 002", "down 003"},
+			applied: []string{"001_a.sql:1"},
+		},
+		{
+			name:    "file by name",
+			keys:    map[any]any{common.FileKey: "003_c.sql"},
+			steps:   []string{"down 003"},
+			applied: []string{"001_a.sql:1", "002_b.sql:3", "004_d.sql:3"},
+		},
+		{
+			name:    "file by version",
+			keys:    map[any]any{common.FileKey: "2"},
+			steps:   []string{"down 002"},
+			applied: []string{"001_a.sql:1", "003_c.sql:2", "004_d.sql:3"},
+		},
+		{
+			name:    "steps cap the last batch",
+			keys:    map[any]any{common.StepsKey: 1},
+			steps:   []string{"down 004"},
+			applied: []string{"001_a.sql:1", "003_c.sql:2", "002_b.sql:3"},
+		},
+		{
+			name:    "steps cap across batches",
+			keys:    map[any]any{common.AllKey: true, common.StepsKey: 3},
+			steps:   []string{"down 004", "down 002", "down 003"},
+			applied: []string{"001_a.sql:1"},
+		},
+		{
+			name:    "file not applied",
+			keys:    map[any]any{common.FileKey: "005_e.sql"},
+			applied: []string{"001_a.sql:1", "003_c.sql:2", "002_b.sql:3", "004_d.sql:3"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := batchedRunner(t)
+
+			ctx := context.Background()
+			for key, value := range tt.keys {
+				ctx = context.WithValue(ctx, key, value)
+			}
+
+			err := runner.Rollback(ctx)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Rollback = %v, want error %v", err, tt.wantErr)
+			}
+
+			if got := trail(t, runner); !reflect.DeepEqual(got, tt.steps) {
+				t.Errorf("ran %v, want %v", got, tt.steps)
+			}
+
+			if got := appliedNames(t, runner); !reflect.DeepEqual(got, tt.applied) {
+				t.Errorf("applied = %v, want %v", got, tt.applied)
+			}
+		})
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	runner := batchedRunner(t)
+
+	if err := runner.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"down 004", "down 002", "down 003", "down 001",
+		"up 001", "up 002", "up 003", "up 004",
+	}
+	if got := trail(t, runner); !reflect.DeepEqual(got, want) {
+		t.Errorf("ran %v, want %v", got, want)
+	}
+
+	applied := []string{"001_a.sql:1", "002_b.sql:1", "003_c.sql:1", "004_d.sql:1"}
+	if got := appliedNames(t, runner); !reflect.DeepEqual(got, applied) {
+		t.Errorf("applied = %v, want %v", got, applied)
+	}
+}
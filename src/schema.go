@@ -0,0 +1,103 @@
+package src
+
+import (
+	"fmt"
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+	"log"
+)
+
+// TrackerTable is migration_table, qualified with the schema on Postgres and the database on
+// MySQL so the tracker finds it whatever the connection defaults to. SQLite has one schema.
+func (cfg *Config) TrackerTable(dialect string) string {
+
+	if cfg.Schema == "" || dialect == "sqlite" {
+		return cfg.GetMigrationTable()
+	}
+
+	return cfg.Schema + "." + cfg.GetMigrationTable()
+}
+
+// trackerTable scopes a query to the migrations table
+func (t *Tracker) trackerTable(db *gorm.DB) *gorm.DB {
+	return db.Table(t.Config.TrackerTable(db.Dialector.Name()))
+}
+
+// EnsureMigrationTable creates the schema, when one is configured, and the migrations table in it
+func EnsureMigrationTable(db *gorm.DB, cfg *Config) error {
+
+	if err := EnsureSchema(db, cfg.Schema); err != nil {
+		return fmt.Errorf("create schema %s: %w", cfg.Schema, err)
+	}
+
+	return db.Table(cfg.TrackerTable(db.Dialector.Name())).AutoMigrate(&MigoMigration{})
+}
+
+// EnsureSchema creates a Postgres schema if it doesn't exist. On MySQL the schema is the
+// database, it is never created and has to be the one the connection uses.
+func EnsureSchema(db *gorm.DB, schema string) error {
+
+	if schema == "" {
+		return nil
+	}
+
+	switch db.Dialector.Name() {
+	case "postgres":
+		return db.Exec(fmt.Sprintf(`CREATE SCHEMA IF NOT EXISTS %q`, schema)).Error
+	case "mysql":
+		var database string
+		if err := db.Raw(`SELECT COALESCE(DATABASE(), '')`).Scan(&database).Error; err != nil {
+			return err
+		}
+
+		if database != schema {
+			return fmt.Errorf("schema %q is not the connected database %q: on mysql schema is the database, leave the database out of the DSN to use schema", schema, database)
+		}
+	case "sqlite":
+		if schema != "main" {
+			log.Printf("⚠️ schema %q is ignored on sqlite", schema)
+		}
+	}
+
+	return nil
+}
+
+// connect opens the configured database with the schema as the default for unqualified names:
+// search_path on Postgres, the DSN database on MySQL. Both live in the DSN so connections the
+// pool opens later get them too, as do role and session_init. A MySQL DSN without a database
+// connects to schema, one naming another database is refused.
+func connect(cfg *Config, dbType string, dsn string) (*gorm.DB, error) {
+
+	session, err := cfg.SessionStatements(dbType)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Schema == "" {
+		return openDB(dbType, dsn, session...)
+	}
+
+	switch dbType {
+	case "postgres":
+		return openDB(dbType, WithSearchPath(dsn, cfg.Schema), session...)
+
+	case "mysql":
+		parsed, err := mysqldriver.ParseDSN(dsn)
+		if err != nil {
+			return nil, fmt.Errorf("parse DSN: %w", err)
+		}
+
+		switch parsed.DBName {
+		case cfg.Schema:
+			return openDB(dbType, dsn, session...)
+		case "":
+			parsed.DBName = cfg.Schema
+
+			return openDB(dbType, parsed.FormatDSN(), session...)
+		default:
+			return nil, fmt.Errorf("schema %q differs from the DSN database %q: on mysql schema is the database, leave the database out of the DSN to use schema", cfg.Schema, parsed.DBName)
+		}
+	}
+
+	return openDB(dbType, dsn, session...)
+}
@@ -0,0 +1,128 @@
+package src
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/mattn/go-sqlite3"
+	"strings"
+)
+
+// SessionStatements are run on every new connection: SET ROLE for role, then session_init in order
+func (cfg *Config) SessionStatements(dialect string) ([]string, error) {
+
+	var statements []string
+
+	if cfg.Role != "" {
+		switch dialect {
+		case "postgres":
+			statements = append(statements, fmt.Sprintf(`SET ROLE %q`, cfg.Role))
+		case "mysql":
+			statements = append(statements, "SET ROLE `"+strings.ReplaceAll(cfg.Role, "`", "``")+"`")
+		default:
+			return nil, fmt.Errorf("role is not supported on %s", dialect)
+		}
+	}
+
+	for _, statement := range cfg.SessionInit {
+		if statement = strings.TrimSpace(statement); statement != "" {
+			statements = append(statements, statement)
+		}
+	}
+
+	return statements, nil
+}
+
+// sessionConnector runs the session statements on each connection the pool opens,
+// so they are back in place after a dropped connection is replaced
+type sessionConnector struct {
+	driver.Connector
+	statements []string
+}
+
+func (c *sessionConnector) Connect(ctx context.Context) (driver.Conn, error) {
+
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	execer, ok := conn.(driver.ExecerContext)
+	if !ok {
+		conn.Close()
+		return nil, fmt.Errorf("session_init: driver can't execute statements")
+	}
+
+	for _, statement := range c.statements {
+		if _, err := execer.ExecContext(ctx, statement, nil); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("session_init %q: %w", statement, err)
+		}
+	}
+
+	return conn, nil
+}
+
+// dsnConnector opens connections of a driver that has no connector of its own
+type dsnConnector struct {
+	dsn    string
+	driver driver.Driver
+}
+
+func (c dsnConnector) Connect(_ context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// openSessionDB opens a pool whose connections all run the statements before first use
+func openSessionDB(dbType string, dsn string, statements []string) (*sql.DB, error) {
+
+	var connector driver.Connector
+
+	switch dbType {
+	case "postgres":
+		config, err := pgx.ParseConfig(dsn)
+		if err != nil {
+			return nil, fmt.Errorf("parse DSN: %w", err)
+		}
+
+		connector = stdlib.GetConnector(*config)
+	case "mysql":
+		config, err := mysqldriver.ParseDSN(dsn)
+		if err != nil {
+			return nil, fmt.Errorf("parse DSN: %w", err)
+		}
+
+		connector, err = mysqldriver.NewConnector(config)
+		if err != nil {
+			return nil, err
+		}
+	case "sqlite":
+		connector = dsnConnector{dsn: dsn, driver: &sqlite3.SQLiteDriver{}}
+	default:
+		return nil, fmt.Errorf("unsupported DB type: %s", dbType)
+	}
+
+	return sql.OpenDB(&sessionConnector{Connector: connector, statements: statements}), nil
+}
+
+// printSession lists the statements every connection runs, for dry runs
+func (r *Runner) printSession() {
+
+	statements, err := r.Config.SessionStatements(r.DB.Dialector.Name())
+	if err != nil || len(statements) == 0 {
+		return
+	}
+
+	fmt.Println("   every connection first runs:")
+	for _, statement := range statements {
+		fmt.Printf("      %s;\n", strings.TrimSuffix(statement, ";"))
+	}
+}
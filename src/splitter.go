@@ -0,0 +1,365 @@
+package src
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Statement is a single SQL statement of a migration block, Line is 1-based within the block
+type Statement struct {
+	SQL  string
+	Line int
+}
+
+// StatementError points at the statement of a migration file that failed
+type StatementError struct {
+	File      string
+	Statement int
+	Line      int
+	Err       error
+}
+
+func (e *StatementError) Error() string {
+	return fmt.Sprintf("statement %d (line %d): %v", e.Statement, e.Line, e.Err)
+}
+
+func (e *StatementError) Unwrap() error {
+	return e.Err
+}
+
+// SplitStatements splits a migration block into statements for the given dialect.
+// It keeps quoted strings, identifiers and comments intact, understands Postgres
+// dollar-quoted and BEGIN ATOMIC bodies, MySQL DELIMITER blocks and SQLite trigger bodies.
+func SplitStatements(sql string, dialect string) []Statement {
+	s := &splitter{
+		src:       sql,
+		dialect:   dialect,
+		delimiter: ";",
+		line:      1,
+		start:     -1,
+	}
+
+	return s.split()
+}
+
+type splitter struct {
+	src       string
+	dialect   string
+	delimiter string
+	pos       int
+	line      int
+
+	statements []Statement
+
+	// start is the offset of the first significant char of the current statement, -1 if none yet
+	start     int
+	startLine int
+
+	// words holds the leading keywords of the current statement, used to detect trigger bodies
+	words []string
+	depth int
+	// previous is the last word read, BEGIN ATOMIC spans two words
+	previous string
+}
+
+func (s *splitter) split() []Statement {
+	for s.pos < len(s.src) {
+		if s.depth == 0 && strings.HasPrefix(s.src[s.pos:], s.delimiter) {
+			s.flush(s.pos)
+			s.advance(len(s.delimiter))
+			continue
+		}
+
+		c := s.src[s.pos]
+		next := s.peek(1)
+
+		switch {
+		case c == '-' && next == '-' && s.isLineComment():
+			s.skipLine()
+		case c == '#' && s.dialect == "mysql":
+			s.skipLine()
+		case c == '/' && next == '*':
+			// MySQL executes /*! ... */ comments, so they are part of the statement
+			if s.dialect == "mysql" && s.peek(2) == '!' {
+				s.mark()
+			}
+			s.skipBlockComment()
+		case c == '\'':
+			s.mark()
+			s.skipQuoted('\'', s.dialect == "mysql" || s.isEscapeString())
+		case c == '"':
+			s.mark()
+			s.skipQuoted('"', s.dialect == "mysql")
+		case c == '`' && s.dialect == "mysql":
+			s.mark()
+			s.skipQuoted('`', false)
+		case c == '[' && s.dialect == "sqlserver":
+			s.mark()
+			s.skipQuoted(']', false)
+		case c == '$' && s.dialect == "postgres":
+			s.mark()
+			s.skipDollarQuoted()
+		case isWordStart(c):
+			s.readWord()
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			s.advance(1)
+		default:
+			s.mark()
+			s.advance(1)
+		}
+	}
+
+	s.flush(len(s.src))
+
+	return s.statements
+}
+
+func (s *splitter) peek(offset int) byte {
+	if s.pos+offset < len(s.src) {
+		return s.src[s.pos+offset]
+	}
+
+	return 0
+}
+
+// advance moves forward n bytes, keeping the line counter in sync
+func (s *splitter) advance(n int) {
+	end := s.pos + n
+	if end > len(s.src) {
+		end = len(s.src)
+	}
+
+	s.line += strings.Count(s.src[s.pos:end], "\n")
+	s.pos = end
+}
+
+func (s *splitter) mark() {
+	if s.start == -1 {
+		s.start = s.pos
+		s.startLine = s.line
+	}
+}
+
+func (s *splitter) flush(end int) {
+	if s.start != -1 {
+		s.statements = append(s.statements, Statement{
+			SQL:  strings.TrimSpace(s.src[s.start:end]),
+			Line: s.startLine,
+		})
+	}
+
+	s.start = -1
+	s.words = nil
+	s.depth = 0
+	s.previous = ""
+}
+
+// isLineComment reports whether "--" starts a comment, MySQL needs whitespace after it
+func (s *splitter) isLineComment() bool {
+	if s.dialect != "mysql" {
+		return true
+	}
+
+	after := s.peek(2)
+
+	return after == 0 || after == ' ' || after == '\t' || after == '\r' || after == '\n'
+}
+
+// isEscapeString reports whether the quote opens a Postgres E'...' string
+func (s *splitter) isEscapeString() bool {
+	if s.dialect != "postgres" || s.pos == 0 {
+		return false
+	}
+
+	prefix := s.src[s.pos-1]
+	if prefix != 'E' && prefix != 'e' {
+		return false
+	}
+
+	return s.pos < 2 || !isWordChar(s.src[s.pos-2], s.dialect)
+}
+
+func (s *splitter) skipLine() {
+	end := strings.IndexByte(s.src[s.pos:], '\n')
+	if end == -1 {
+		s.advance(len(s.src) - s.pos)
+		return
+	}
+
+	s.advance(end)
+}
+
+// skipBlockComment skips /* ... */, Postgres allows these to nest
+func (s *splitter) skipBlockComment() {
+	depth := 0
+	i := s.pos
+
+	for i < len(s.src) {
+		switch {
+		case strings.HasPrefix(s.src[i:], "/*"):
+			if depth == 0 || s.dialect == "postgres" {
+				depth++
+			}
+			i += 2
+		case strings.HasPrefix(s.src[i:], "*/"):
+			depth--
+			i += 2
+			if depth == 0 {
+				s.advance(i - s.pos)
+				return
+			}
+		default:
+			i++
+		}
+	}
+
+	s.advance(i - s.pos)
+}
+
+// skipQuoted skips a quoted string or identifier, a doubled quote is an escaped quote
+func (s *splitter) skipQuoted(quote byte, backslash bool) {
+	i := s.pos + 1
+
+	for i < len(s.src) {
+		c := s.src[i]
+
+		if backslash && c == '\\' {
+			i += 2
+			continue
+		}
+
+		if c == quote {
+			if i+1 < len(s.src) && s.src[i+1] == quote {
+				i += 2
+				continue
+			}
+
+			i++
+			break
+		}
+
+		i++
+	}
+
+	s.advance(i - s.pos)
+}
+
+// skipDollarQuoted skips a $tag$ ... $tag$ body, a bare $1 parameter is left alone
+func (s *splitter) skipDollarQuoted() {
+	i := s.pos + 1
+
+	for i < len(s.src) && s.src[i] != '$' {
+		c := s.src[i]
+		if !(c == '_' || c >= 0x80 || unicode.IsLetter(rune(c)) || (i > s.pos+1 && unicode.IsDigit(rune(c)))) {
+			s.advance(1)
+			return
+		}
+		i++
+	}
+
+	if i >= len(s.src) {
+		s.advance(1)
+		return
+	}
+
+	tag := s.src[s.pos : i+1]
+
+	end := strings.Index(s.src[i+1:], tag)
+	if end == -1 {
+		s.advance(len(s.src) - s.pos)
+		return
+	}
+
+	s.advance(i + 1 + end + len(tag) - s.pos)
+}
+
+func (s *splitter) readWord() {
+	i := s.pos
+	// a DELIMITER such as $$ can follow a word directly ("END$$"), and MySQL allows $ in words
+	for i < len(s.src) && isWordChar(s.src[i], s.dialect) && !strings.HasPrefix(s.src[i:], s.delimiter) {
+		_, size := utf8.DecodeRuneInString(s.src[i:])
+		i += size
+	}
+
+	word := strings.ToUpper(s.src[s.pos:i])
+
+	// DELIMITER is a client command, it changes the terminator and is never sent to the server
+	if s.dialect == "mysql" && s.start == -1 && word == "DELIMITER" {
+		s.advance(i - s.pos)
+
+		end := strings.IndexByte(s.src[s.pos:], '\n')
+		if end == -1 {
+			end = len(s.src) - s.pos
+		}
+
+		if fields := strings.Fields(s.src[s.pos : s.pos+end]); len(fields) > 0 {
+			s.delimiter = fields[0]
+		}
+
+		s.advance(end)
+		return
+	}
+
+	s.mark()
+	s.advance(i - s.pos)
+
+	if len(s.words) < 3 {
+		s.words = append(s.words, word)
+	}
+
+	previous := s.previous
+	s.previous = word
+
+	if s.dialect == "sqlite" && s.isTrigger() {
+		switch word {
+		case "BEGIN", "CASE":
+			s.depth++
+		case "END":
+			if s.depth > 0 {
+				s.depth--
+			}
+		}
+	}
+
+	// a SQL-standard function body, BEGIN ATOMIC ... END, holds semicolons; CASE ... END
+	// expressions inside it are counted so their END doesn't close the body
+	if s.dialect == "postgres" {
+		switch {
+		case word == "ATOMIC" && previous == "BEGIN":
+			s.depth++
+		case word == "CASE" && s.depth > 0:
+			s.depth++
+		case word == "END" && s.depth > 0:
+			s.depth--
+		}
+	}
+}
+
+// isTrigger reports whether the current statement is CREATE [TEMP] TRIGGER, its body holds semicolons
+func (s *splitter) isTrigger() bool {
+	if len(s.words) < 2 || s.words[0] != "CREATE" {
+		return false
+	}
+
+	for _, word := range s.words[1:] {
+		if word == "TRIGGER" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isWordStart(c byte) bool {
+	return c == '_' || c >= 0x80 || unicode.IsLetter(rune(c))
+}
+
+func isWordChar(c byte, dialect string) bool {
+	if c == '$' {
+		return dialect == "postgres" || dialect == "mysql"
+	}
+
+	return isWordStart(c) || unicode.IsDigit(rune(c))
+}
@@ -0,0 +1,209 @@
+package src
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect string
+		sql     string
+		want    []string
+	}{
+		{
+			name:    "plain statements",
+			dialect: "postgres",
+			sql:     "CREATE TABLE a (id int);\nINSERT INTO a VALUES (1);",
+			want:    []string{"CREATE TABLE a (id int)", "INSERT INTO a VALUES (1)"},
+		},
+		{
+			name:    "no trailing delimiter",
+			dialect: "postgres",
+			sql:     "SELECT 1",
+			want:    []string{"SELECT 1"},
+		},
+		{
+			name:    "empty statements are dropped",
+			dialect: "postgres",
+			sql:     " ; ;\n;",
+			want:    nil,
+		},
+		{
+			name:    "semicolon in a string",
+			dialect: "postgres",
+			sql:     "INSERT INTO a VALUES ('x;y'); SELECT 1;",
+			want:    []string{"INSERT INTO a VALUES ('x;y')", "SELECT 1"},
+		},
+		{
+			name:    "doubled quote",
+			dialect: "postgres",
+			sql:     "SELECT 'it''s;'; SELECT 2;",
+			want:    []string{"SELECT 'it''s;'", "SELECT 2"},
+		},
+		{
+			name:    "semicolon in a quoted identifier",
+			dialect: "postgres",
+			sql:     `SELECT 1 AS "a;b"; SELECT 2;`,
+			want:    []string{`SELECT 1 AS "a;b"`, "SELECT 2"},
+		},
+		{
+			name:    "postgres backslash is literal in a standard string",
+			dialect: "postgres",
+			sql:     `SELECT 'a\'; SELECT 2;`,
+			want:    []string{`SELECT 'a\'`, "SELECT 2"},
+		},
+		{
+			name:    "postgres E string escapes a quote with a backslash",
+			dialect: "postgres",
+			sql:     `SELECT E'a\';b'; SELECT 2;`,
+			want:    []string{`SELECT E'a\';b'`, "SELECT 2"},
+		},
+		{
+			name:    "postgres lower-case e string",
+			dialect: "postgres",
+			sql:     `SELECT e'\'; SELECT 2;';`,
+			want:    []string{`SELECT e'\'; SELECT 2;'`},
+		},
+		{
+			name:    "mysql backslash escapes",
+			dialect: "mysql",
+			sql:     `INSERT INTO a VALUES ('a\';b'); SELECT 2;`,
+			want:    []string{`INSERT INTO a VALUES ('a\';b')`, "SELECT 2"},
+		},
+		{
+			name:    "mysql backtick identifier",
+			dialect: "mysql",
+			sql:     "SELECT 1 AS `a;b`; SELECT 2;",
+			want:    []string{"SELECT 1 AS `a;b`", "SELECT 2"},
+		},
+		{
+			name:    "dollar-quoted function body",
+			dialect: "postgres",
+			sql:     "CREATE FUNCTION f() RETURNS int AS $$ BEGIN RETURN 1; END; $$ LANGUAGE plpgsql;\nSELECT f();",
+			want:    []string{"CREATE FUNCTION f() RETURNS int AS $$ BEGIN RETURN 1; END; $$ LANGUAGE plpgsql", "SELECT f()"},
+		},
+		{
+			name:    "tagged dollar quote containing $$",
+			dialect: "postgres",
+			sql:     "DO $body$ BEGIN RAISE NOTICE '$$;'; END $body$; SELECT 1;",
+			want:    []string{"DO $body$ BEGIN RAISE NOTICE '$$;'; END $body$", "SELECT 1"},
+		},
+		{
+			name:    "positional parameter is not a dollar quote",
+			dialect: "postgres",
+			sql:     "PREPARE p AS SELECT $1; SELECT 2;",
+			want:    []string{"PREPARE p AS SELECT $1", "SELECT 2"},
+		},
+		{
+			name:    "begin atomic function body",
+			dialect: "postgres",
+			sql: "CREATE FUNCTION add(a int, b int) RETURNS int LANGUAGE SQL\n" +
+				"BEGIN ATOMIC\n  SELECT CASE WHEN a > 0 THEN a + b END;\n  SELECT a - b;\nEND;\nSELECT 1;",
+			want: []string{
+				"CREATE FUNCTION add(a int, b int) RETURNS int LANGUAGE SQL\n" +
+					"BEGIN ATOMIC\n  SELECT CASE WHEN a > 0 THEN a + b END;\n  SELECT a - b;\nEND",
+				"SELECT 1",
+			},
+		},
+		{
+			name:    "begin transaction is not a block",
+			dialect: "postgres",
+			sql:     "BEGIN; SELECT 1; END;",
+			want:    []string{"BEGIN", "SELECT 1", "END"},
+		},
+		{
+			name:    "mysql delimiter block",
+			dialect: "mysql",
+			sql: "DELIMITER //\nCREATE PROCEDURE p() BEGIN SELECT 1; SELECT 2; END//\n" +
+				"DELIMITER ;\nSELECT 3;",
+			want: []string{"CREATE PROCEDURE p() BEGIN SELECT 1; SELECT 2; END", "SELECT 3"},
+		},
+		{
+			name:    "mysql delimiter with two characters on the same line",
+			dialect: "mysql",
+			sql:     "DELIMITER $$\nCREATE TRIGGER t BEFORE INSERT ON a FOR EACH ROW BEGIN SET NEW.x = 1; END$$\nDELIMITER ;",
+			want:    []string{"CREATE TRIGGER t BEFORE INSERT ON a FOR EACH ROW BEGIN SET NEW.x = 1; END"},
+		},
+		{
+			name:    "sqlite trigger body",
+			dialect: "sqlite",
+			sql: "CREATE TRIGGER t AFTER INSERT ON a BEGIN\n" +
+				"  UPDATE a SET x = CASE WHEN 1 THEN 2 END;\n  DELETE FROM b;\nEND;\nSELECT 1;",
+			want: []string{
+				"CREATE TRIGGER t AFTER INSERT ON a BEGIN\n  UPDATE a SET x = CASE WHEN 1 THEN 2 END;\n  DELETE FROM b;\nEND",
+				"SELECT 1",
+			},
+		},
+		{
+			name:    "sqlite temp trigger body",
+			dialect: "sqlite",
+			sql:     "CREATE TEMP TRIGGER t AFTER DELETE ON a BEGIN DELETE FROM b; END; SELECT 1;",
+			want:    []string{"CREATE TEMP TRIGGER t AFTER DELETE ON a BEGIN DELETE FROM b; END", "SELECT 1"},
+		},
+		{
+			name:    "line and block comments",
+			dialect: "postgres",
+			sql:     "-- first; comment\nSELECT 1; /* x; y */ SELECT 2;",
+			want:    []string{"SELECT 1", "SELECT 2"},
+		},
+		{
+			name:    "trailing line comment stays in the statement",
+			dialect: "postgres",
+			sql:     "SELECT 1 -- one; two\n, 2;",
+			want:    []string{"SELECT 1 -- one; two\n, 2"},
+		},
+		{
+			name:    "postgres nested block comments",
+			dialect: "postgres",
+			sql:     "/* a /* b; */ c; */ SELECT 1;",
+			want:    []string{"SELECT 1"},
+		},
+		{
+			name:    "mysql hash comment",
+			dialect: "mysql",
+			sql:     "# note; here\nSELECT 1;",
+			want:    []string{"SELECT 1"},
+		},
+		{
+			name:    "mysql double dash needs whitespace",
+			dialect: "mysql",
+			sql:     "SELECT 1--1; SELECT 2;",
+			want:    []string{"SELECT 1--1", "SELECT 2"},
+		},
+		{
+			name:    "mysql executable comment is kept",
+			dialect: "mysql",
+			sql:     "/*!40101 SET NAMES utf8 */; SELECT 1;",
+			want:    []string{"/*!40101 SET NAMES utf8 */", "SELECT 1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, statement := range SplitStatements(tt.sql, tt.dialect) {
+				got = append(got, statement.SQL)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitStatements() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitStatementsLines(t *testing.T) {
+	sql := "-- header\nSELECT 1;\n\nSELECT\n  2;\n'x';"
+
+	var got []int
+	for _, statement := range SplitStatements(sql, "postgres") {
+		got = append(got, statement.Line)
+	}
+
+	want := []int{2, 4, 6}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("lines = %v, want %v", got, want)
+	}
+}
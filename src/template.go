@@ -0,0 +1,89 @@
+package src
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// TemplateData is what migration SQL can reference with {{ ... }}
+type TemplateData struct {
+	Schema         string
+	Dialect        string
+	MigrationTable string
+	Env            string
+	Vars           map[string]string
+}
+
+var templateFuncs = template.FuncMap{
+	// env fails the render when the variable is unset, like an undefined .Vars key
+	"env": func(name string) (string, error) {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+
+		return value, nil
+	},
+}
+
+// RenderSQL executes a migration block as a text/template. Blocks without "{{" are returned
+// unchanged, and a missing variable is an error instead of "<no value>".
+func RenderSQL(name string, sql string, data TemplateData) (string, error) {
+	if !strings.Contains(sql, "{{") {
+		return sql, nil
+	}
+
+	tmpl, err := template.New(name).Option("missingkey=error").Funcs(templateFuncs).Parse(sql)
+	if err != nil {
+		return "", fmt.Errorf("parse template (add %sno-template to run it as plain SQL): %w", DirectivePrefix, err)
+	}
+
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("render template: %w", err)
+	}
+
+	return out.String(), nil
+}
+
+// templateData holds the built-ins and config vars for this run
+func (r *Runner) templateData() (TemplateData, error) {
+
+	schema, err := r.templateSchema()
+	if err != nil {
+		return TemplateData{}, err
+	}
+
+	return TemplateData{
+		Schema:         schema,
+		Dialect:        r.DB.Dialector.Name(),
+		MigrationTable: r.Config.GetMigrationTable(),
+		Env:            r.Config.Environment,
+		Vars:           r.Config.Vars,
+	}, nil
+}
+
+// templateSchema is where unqualified names land: schema when set, otherwise public on
+// Postgres and the connected database on MySQL. SQLite ignores schema and only has main.
+func (r *Runner) templateSchema() (string, error) {
+
+	switch r.DB.Dialector.Name() {
+	case "sqlite":
+		return "main", nil
+	case "mysql":
+		if r.Config.Schema != "" {
+			return r.Config.Schema, nil
+		}
+
+		var database string
+		if err := r.DB.Raw(`SELECT COALESCE(DATABASE(), '')`).Scan(&database).Error; err != nil {
+			return "", fmt.Errorf("read connected database: %w", err)
+		}
+
+		return database, nil
+	default:
+		return r.Config.GetSchemaName(), nil
+	}
+}
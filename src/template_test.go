@@ -0,0 +1,92 @@
+package src
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRenderSQL(t *testing.T) {
+	t.Setenv("MIGO_TEST_ROLE", "replica")
+
+	data := TemplateData{
+		Schema:         "billing",
+		Dialect:        "postgres",
+		MigrationTable: "migo_migrations",
+		Env:            "prod",
+		Vars:           map[string]string{"prefix": "acme_"},
+	}
+
+	tests := []struct {
+		name    string
+		sql     string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "built-ins and vars",
+			sql:  "CREATE TABLE {{ .Schema }}.{{ .Vars.prefix }}invoices (); -- {{ .Dialect }} {{ .Env }} {{ .MigrationTable }}",
+			want: "CREATE TABLE billing.acme_invoices (); -- postgres prod migo_migrations",
+		},
+		{
+			name: "env",
+			sql:  `GRANT SELECT ON invoices TO {{ env "MIGO_TEST_ROLE" }};`,
+			want: "GRANT SELECT ON invoices TO replica;",
+		},
+		{
+			name: "no template",
+			sql:  "SELECT '{ not a template }';",
+			want: "SELECT '{ not a template }';",
+		},
+		{
+			name:    "missing var",
+			sql:     "CREATE TABLE {{ .Vars.missing }}invoices ();",
+			wantErr: "missing",
+		},
+		{
+			name:    "unset env",
+			sql:     `SELECT '{{ env "MIGO_TEST_UNSET" }}';`,
+			wantErr: "MIGO_TEST_UNSET is not set",
+		},
+		{
+			name:    "parse error points at no-template",
+			sql:     "SELECT '{{1,2},{3,4}}'::int[];",
+			wantErr: "no-template",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RenderSQL("001_a.sql", tt.sql, data)
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("RenderSQL() = %q, %v, want an error mentioning %q", got, err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil || got != tt.want {
+				t.Errorf("RenderSQL() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplatesInMigrations(t *testing.T) {
+	runner := trailRunner(t, &Config{Schema: "billing", Vars: map[string]string{"step": "vars"}}, fstest.MapFS{
+		// sqlite has no schemas besides main, whatever schema is set to
+		"001_schema.sql": migrationFile("INSERT INTO {{ .Schema }}.trail (step) VALUES ('{{ .Schema }} {{ .Vars.step }}');", ""),
+		"002_raw.sql":    {Data: []byte("-- migo:no-template\n[UP]\nINSERT INTO trail (step) VALUES ('{{ .Schema }}');\n[/UP]\n")},
+	})
+
+	if err := runner.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := trail(t, runner); !reflect.DeepEqual(got, []string{"main vars", "{{ .Schema }}"}) {
+		t.Errorf("ran %v", got)
+	}
+}
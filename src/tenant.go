@@ -0,0 +1,134 @@
+package src
+
+import (
+	"context"
+	"fmt"
+	"github.com/sagar290/migo/common"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TenantConfig lists the schemas of a schema-per-tenant Postgres database
+type TenantConfig struct {
+	// Schemas are migrated as listed
+	Schemas []string `mapstructure:"schemas" yaml:"schemas,omitempty"`
+	// Query returns one schema name per row, its results are added to Schemas
+	Query string `mapstructure:"query" yaml:"query,omitempty"`
+	// Parallelism is how many schemas are migrated at once, 1 when unset
+	Parallelism int `mapstructure:"parallelism" yaml:"parallelism,omitempty"`
+}
+
+// TenantResult is the outcome of migrating one tenant schema
+type TenantResult struct {
+	Schema   string
+	Err      error
+	Duration time.Duration
+}
+
+// UpAllTenants runs Up against every tenant schema. Each schema gets its own connection with
+// search_path set to it, so unqualified DDL and the migrations table both land in the schema.
+// Every tenant is attempted; the error reports how many failed.
+func (r *Runner) UpAllTenants(ctx context.Context) ([]TenantResult, error) {
+
+	if r.DB.Dialector.Name() != "postgres" {
+		return nil, fmt.Errorf("--all-tenants needs postgres, got %s", r.DB.Dialector.Name())
+	}
+
+	schemas, err := r.tenantSchemas(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	dsn, err := r.Config.DSN()
+	if err != nil {
+		return nil, fmt.Errorf("--all-tenants opens a connection per schema and needs the DSN: %w", err)
+	}
+
+	results := make([]TenantResult, len(schemas))
+
+	errs, _ := runEach(ctx, len(schemas), r.Config.Tenants.Parallelism, false, func(i int) error {
+		started := time.Now()
+		err := r.upTenant(ctx, dsn, schemas[i])
+		results[i] = TenantResult{Schema: schemas[i], Err: err, Duration: time.Since(started)}
+
+		return err
+	})
+
+	failed := 0
+	for _, err := range errs {
+		if err != nil {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return results, fmt.Errorf("%d of %d tenant(s) failed", failed, len(results))
+	}
+
+	return results, nil
+}
+
+// tenantSchemas merges the configured list with the query results, keeping the first occurrence
+func (r *Runner) tenantSchemas(ctx context.Context) ([]string, error) {
+
+	schemas := append([]string(nil), r.Config.Tenants.Schemas...)
+
+	if r.Config.Tenants.Query != "" {
+		var found []string
+		if err := r.DB.WithContext(ctx).Raw(r.Config.Tenants.Query).Scan(&found).Error; err != nil {
+			return nil, fmt.Errorf("tenants query: %w", err)
+		}
+
+		schemas = append(schemas, found...)
+	}
+
+	seen := map[string]bool{}
+	var unique []string
+	for _, schema := range schemas {
+		if schema != "" && !seen[schema] {
+			seen[schema] = true
+			unique = append(unique, schema)
+		}
+	}
+
+	if len(unique) == 0 {
+		return nil, fmt.Errorf("no tenant schemas found: set tenants.schemas or tenants.query")
+	}
+
+	return unique, nil
+}
+
+// upTenant migrates one schema with a runner of its own
+func (r *Runner) upTenant(ctx context.Context, dsn string, schema string) error {
+
+	cfg := *r.Config
+	cfg.Schema = schema
+
+	// a dry run must not create a mistyped schema or its migrations table
+	dry, _ := ctx.Value(common.DryRunKey).(bool)
+
+	return withConnection(&cfg, "postgres", dsn, migrationSource(&cfg, r.Tracker), !dry, func(runner Migrator) error {
+		return runner.Up(ctx)
+	})
+}
+
+// WithSearchPath adds search_path to a Postgres URL or key=value DSN, so every pooled
+// connection, including ones opened after a reconnect, starts in the schema
+func WithSearchPath(dsn string, schema string) string {
+	// quoted so mixed-case schema names are not folded to lower case
+	searchPath := `"` + strings.ReplaceAll(schema, `"`, `""`) + `"`
+
+	if strings.Contains(dsn, "://") {
+		u, err := url.Parse(dsn)
+		if err == nil {
+			query := u.Query()
+			query.Set("search_path", searchPath)
+			u.RawQuery = query.Encode()
+
+			return u.String()
+		}
+	}
+
+	return fmt.Sprintf("%s search_path='%s'", dsn, strings.ReplaceAll(searchPath, "'", `\'`))
+}
@@ -0,0 +1,5 @@
+-- +goose Up
+CREATE TABLE orders (id INT PRIMARY KEY, total DECIMAL(10, 2) NOT NULL);
+
+-- +goose Down
+DROP TABLE orders;
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE PROCEDURE order_total(IN order_id INT, OUT result DECIMAL(10, 2))
+BEGIN
+    SELECT total INTO result FROM orders WHERE id = order_id;
+    SET result = COALESCE(result, 0);
+END;
+-- +goose StatementEnd
+
+INSERT INTO orders (id, total) VALUES (1, 9.99);
+
+-- +goose Down
+DROP PROCEDURE order_total;
@@ -1,20 +1,21 @@
 package src
 
 import (
-	"bufio"
-	"bytes"
 	"context"
 	"fmt"
 	"gorm.io/gorm"
-	"io/ioutil"
+	"io/fs"
 	"log"
 	"os"
-	"path/filepath"
+	"path"
 	"sort"
 	"strings"
 	"time"
 )
 
+// NoTransactionDirective opts a file out of transactional execution when placed in the file header
+const NoTransactionDirective = DirectivePrefix + "no-transaction"
+
 type AppliedMigration struct {
 	ID        uint
 	Migration string
@@ -25,13 +26,28 @@ type AppliedMigration struct {
 type Tracker struct {
 	AppliedMigrations map[string]MigoMigration
 	MigrationFiles    []string
+	AllMigrationFiles []string
 	LastBatch         int
 	Config            *Config
+	Source            fs.FS
+
+	// paths maps a migration key to its path inside Source, the up half for paired files
+	paths map[string]string
+	// downPaths maps the key of a paired migration to its .down.sql half
+	downPaths map[string]string
 }
 
+// NewTracker reads migrations from Config.MigrationsDir on disk
 func NewTracker(config *Config) *Tracker {
+	return NewTrackerFS(config, os.DirFS(config.GetMigrationDir()))
+}
+
+// NewTrackerFS reads migrations from any fs.FS, such as an embed.FS or fstest.MapFS.
+// Migrations are tracked by their base name, wherever they sit inside source.
+func NewTrackerFS(config *Config, source fs.FS) *Tracker {
 	return &Tracker{
 		Config: config,
+		Source: source,
 	}
 }
 
@@ -46,6 +62,11 @@ func (t *Tracker) InitTracker(ctx context.Context, db *gorm.DB) error {
 		return fmt.Errorf("ListSqlFiles: %w", err)
 	}
 
+	err = t.upgradeTrackedNames(ctx, db)
+	if err != nil {
+		return fmt.Errorf("upgradeTrackedNames: %w", err)
+	}
+
 	err = t.FilterNewMigrations()
 	if err != nil {
 		return fmt.Errorf("FilterNewMigrations: %w", err)
@@ -62,15 +83,22 @@ func (t *Tracker) PrepareAppliedMigrations(ctx context.Context, db *gorm.DB) err
 
 	var records []MigoMigration
 
+	// a dry run doesn't create the migrations table, without one nothing is applied yet
+	if !db.Migrator().HasTable(t.Config.TrackerTable(db.Dialector.Name())) {
+		t.LastBatch = 0
+		t.AppliedMigrations = map[string]MigoMigration{}
+
+		return nil
+	}
+
 	// prepare last batch id
-	query := fmt.Sprintf("SELECT COALESCE(MAX(batch), 0) FROM %s", t.Config.GetMigrationTable())
-	err := db.Raw(query).Scan(&t.LastBatch).Error
+	err := t.trackerTable(db.WithContext(ctx)).Select("COALESCE(MAX(batch), 0)").Scan(&t.LastBatch).Error
 	if err != nil {
 		return fmt.Errorf("get last batch: %w", err)
 	}
 
 	// prepare Applied migration files
-	results := db.WithContext(ctx).Table(t.Config.GetMigrationTable()).Scan(&records)
+	results := t.trackerTable(db.WithContext(ctx)).Scan(&records)
 	if results.Error != nil {
 		return results.Error
 	}
@@ -85,6 +113,8 @@ func (t *Tracker) PrepareAppliedMigrations(ctx context.Context, db *gorm.DB) err
 }
 
 func (t *Tracker) FilterNewMigrations() error {
+	t.AllMigrationFiles = append([]string(nil), t.MigrationFiles...)
+
 	var filtered []string
 	for _, file := range t.MigrationFiles {
 		if _, ok := t.AppliedMigrations[file]; !ok {
@@ -97,14 +127,46 @@ func (t *Tracker) FilterNewMigrations() error {
 	return nil
 }
 
+// ListSqlFiles collects the .sql files from the source together with the Go migrations.
+// A NNN_name.up.sql / NNN_name.down.sql pair is tracked as NNN_name.sql.
 func (t *Tracker) ListSqlFiles() error {
-	err := filepath.Walk(t.Config.MigrationsDir, func(path string, info os.FileInfo, err error) error {
+	t.MigrationFiles = nil
+	t.paths = map[string]string{}
+	t.downPaths = map[string]string{}
+	goFiles := map[string]bool{}
+
+	err := fs.WalkDir(t.Source, ".", func(name string, entry fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
 
-		if !info.IsDir() && filepath.Ext(info.Name()) == ".sql" {
-			t.MigrationFiles = append(t.MigrationFiles, path)
+		if !entry.IsDir() && strings.HasSuffix(name, DownFileSuffix) {
+			key := pairedKey(name)
+			if existing, ok := t.downPaths[key]; ok {
+				return fmt.Errorf("duplicate migration %s: found at %s and %s", key, existing, name)
+			}
+
+			t.downPaths[key] = name
+			return nil
+		}
+
+		if !entry.IsDir() && path.Ext(name) == ".sql" {
+			key := MigrationKey(name)
+			if strings.HasSuffix(name, UpFileSuffix) {
+				key = pairedKey(name)
+			}
+
+			if existing, ok := t.paths[key]; ok {
+				return fmt.Errorf("duplicate migration %s: found at %s and %s", key, existing, name)
+			}
+
+			t.paths[key] = name
+			t.MigrationFiles = append(t.MigrationFiles, key)
+		}
+
+		// Go migrations found on disk stay visible even when this binary didn't register them
+		if !entry.IsDir() && goMigrationFile.MatchString(entry.Name()) {
+			goFiles[entry.Name()] = true
 		}
 
 		return nil
@@ -114,75 +176,151 @@ func (t *Tracker) ListSqlFiles() error {
 		return err
 	}
 
+	for key, name := range t.downPaths {
+		if _, ok := t.paths[key]; !ok {
+			return fmt.Errorf("migration %s has no matching %s file", name, UpFileSuffix)
+		}
+	}
+
+	for _, name := range RegisteredGoMigrations() {
+		goFiles[name] = true
+	}
+
+	for name := range goFiles {
+		t.MigrationFiles = append(t.MigrationFiles, name)
+	}
+
 	sort.Strings(t.MigrationFiles)
 
 	return nil
 }
 
-func (t *Tracker) ExtractUpBlock(file string) (string, error) {
+// upgradeTrackedNames renames rows tracked by path (e.g. "migrations/2024..._x.sql")
+// to their key, a one-time upgrade for tables written by older releases
+func (t *Tracker) upgradeTrackedNames(ctx context.Context, db *gorm.DB) error {
+
+	for name, record := range t.AppliedMigrations {
+		key := MigrationKey(name)
+		if key == name {
+			continue
+		}
+
+		if _, exists := t.AppliedMigrations[key]; exists {
+			log.Printf("⚠️ Not renaming %s to %s: a row with that name already exists", name, key)
+			continue
+		}
+
+		err := t.trackerTable(db.WithContext(ctx)).Where("migration = ?", name).Update("migration", key).Error
+		if err != nil {
+			return err
+		}
 
-	content, err := ioutil.ReadFile(file)
+		delete(t.AppliedMigrations, name)
+		record.Migration = key
+		t.AppliedMigrations[key] = record
+	}
+
+	return nil
+}
+
+// readFile reads a migration file from the tracker source
+func (t *Tracker) readFile(file string) ([]byte, error) {
+	name, ok := t.paths[file]
+	if !ok {
+		name = file
+	}
+
+	content, err := fs.ReadFile(t.Source, name)
 	if err != nil {
-		return "", fmt.Errorf("read file %s: %w", file, err)
+		return nil, fmt.Errorf("read file %s: %w", file, err)
 	}
 
-	var out bytes.Buffer
+	return content, nil
+}
 
-	scanner := bufio.NewScanner(strings.NewReader(string(content)))
+// Block is a migration block together with the file line its first line came from
+type Block struct {
+	File string
+	SQL  string
+	Line int
+}
 
-	insideUpBlock := false
-	for scanner.Scan() {
-		line := scanner.Text()
-		trimmedLine := strings.TrimSpace(line)
+func (t *Tracker) ExtractUpBlock(file string) (string, error) {
 
-		switch trimmedLine {
-		case "[UP]":
-			insideUpBlock = true
-		case "[/UP]":
-			insideUpBlock = false
-		case "[DOWN]":
-			insideUpBlock = false
-		default:
-			if insideUpBlock {
-				out.WriteString(line + "\n")
-			}
-		}
+	block, err := t.LocateUpBlock(file)
+	if err != nil {
+		return "", err
 	}
 
-	return out.String(), nil
+	return block.SQL, nil
 }
 
 func (t *Tracker) ExtractDownBlock(file string) (string, error) {
 
-	content, err := ioutil.ReadFile(file)
+	block, err := t.LocateDownBlock(file)
 	if err != nil {
-		return "", fmt.Errorf("read file %s: %w", file, err)
+		return "", err
 	}
 
-	var out bytes.Buffer
+	return block.SQL, nil
+}
 
-	scanner := bufio.NewScanner(strings.NewReader(string(content)))
+// LocateUpBlock returns the up block and where it starts in the file
+func (t *Tracker) LocateUpBlock(file string) (Block, error) {
+	return t.locateBlock(file, true)
+}
 
-	insideUpBlock := false
-	for scanner.Scan() {
-		line := scanner.Text()
-		trimmedLine := strings.TrimSpace(line)
+// LocateDownBlock returns the down block and where it starts in the file
+func (t *Tracker) LocateDownBlock(file string) (Block, error) {
+	return t.locateBlock(file, false)
+}
 
-		switch trimmedLine {
-		case "[DOWN]":
-			insideUpBlock = true
-		case "[/DOWN]":
-			insideUpBlock = false
-		case "[UP]":
-			insideUpBlock = false
-		default:
-			if insideUpBlock {
-				out.WriteString(line + "\n")
-			}
+func (t *Tracker) locateBlock(file string, up bool) (Block, error) {
+
+	// each half of a pair is a whole block, a missing down half is an empty block
+	if down, ok := t.downPaths[file]; ok || IsPairedFile(t.paths[file]) {
+		name := t.paths[file]
+		if !up {
+			name = down
+		}
+
+		if name == "" {
+			return Block{File: file}, nil
 		}
+
+		content, err := fs.ReadFile(t.Source, name)
+		if err != nil {
+			return Block{}, fmt.Errorf("read file %s: %w", name, err)
+		}
+
+		return Block{File: file, SQL: string(content), Line: 1}, nil
+	}
+
+	content, err := t.readFile(file)
+	if err != nil {
+		return Block{}, err
 	}
 
-	return out.String(), nil
+	block := DetectFileFormat(content).Locate(content, up)
+	block.File = file
+
+	return block, nil
+}
+
+// UseTransaction reports whether the file may run inside a transaction
+func (t *Tracker) UseTransaction(file string) (bool, error) {
+
+	directives, err := t.Directives(file)
+	if err != nil {
+		return false, err
+	}
+
+	return !directives.NoTransaction, nil
+}
+
+// GetGoMigration returns the registered Go migration for a tracked name
+func (t *Tracker) GetGoMigration(file string) (*GoMigration, bool) {
+	return lookupGoMigration(file)
 }
 
 func (t *Tracker) GetMigrationFiles() []string {
@@ -202,29 +340,75 @@ func (t *Tracker) GetAppliedMigrations() []string {
 	return files
 }
 
+// GetAppliedMigrationRecords returns the tracker rows ordered by migration name
+func (t *Tracker) GetAppliedMigrationRecords() []MigoMigration {
+
+	records := make([]MigoMigration, 0, len(t.AppliedMigrations))
+
+	for _, record := range t.AppliedMigrations {
+		records = append(records, record)
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Migration < records[j].Migration
+	})
+
+	return records
+}
+
+// Checksum hashes the UP block of a migration file, Go migrations have none
+func (t *Tracker) Checksum(file string) (string, error) {
+
+	if IsGoMigration(file) {
+		return "", nil
+	}
+
+	block, err := t.ExtractUpBlock(file)
+	if err != nil {
+		return "", err
+	}
+
+	return ChecksumOf(block), nil
+}
+
 func (t *Tracker) AddMigrationInfo(ctx context.Context, db *gorm.DB, file string) error {
 
-	if err := db.WithContext(ctx).Create(&MigoMigration{
-		Migration: file,
-		Batch:     t.GetLastBatch() + 1,
-	}).Error; err != nil {
-		log.Fatalf("❌ Failed to add migration: %v", err)
+	checksum, err := t.Checksum(file)
+	if err != nil {
 		return err
 	}
 
+	directives, err := t.Directives(file)
+	if err != nil {
+		return err
+	}
+
+	if err := t.trackerTable(db.WithContext(ctx)).Create(&MigoMigration{
+		Migration:    file,
+		Batch:        t.GetLastBatch() + 1,
+		Checksum:     checksum,
+		Irreversible: directives.Irreversible,
+	}).Error; err != nil {
+		return fmt.Errorf("add migration %s: %w", file, err)
+	}
+
 	return nil
 }
 
 func (t *Tracker) RemoveMigrationInfo(ctx context.Context, db *gorm.DB, file string) error {
 
-	if err := db.Where("migration = ?", file).Delete(&MigoMigration{}).Error; err != nil {
-		log.Fatalf("❌ Failed to delete migration: %v", err)
-		return err
+	if err := t.trackerTable(db.WithContext(ctx)).Where("migration = ?", file).Delete(&MigoMigration{}).Error; err != nil {
+		return fmt.Errorf("delete migration %s: %w", file, err)
 	}
 
 	return nil
 }
 
+func (t *Tracker) UpdateChecksum(ctx context.Context, db *gorm.DB, file string, checksum string) error {
+
+	return t.trackerTable(db.WithContext(ctx)).Where("migration = ?", file).Update("checksum", checksum).Error
+}
+
 func (t *Tracker) GetAppliedMigrationFileByBatchId(batchId int) []string {
 
 	var files []string
@@ -0,0 +1,55 @@
+package src
+
+import (
+	"path"
+	"strings"
+)
+
+// MigrationKey is the name a migration is tracked by: its base name, so moving files between
+// directories or changing migrations_dir doesn't make them look pending again
+func MigrationKey(name string) string {
+	return path.Base(strings.ReplaceAll(name, "\\", "/"))
+}
+
+// MigrationVersion returns the version prefix of a migration name, e.g. "20240101120000"
+// for "20240101120000_create_users.sql"
+func MigrationVersion(name string) string {
+	base := path.Base(name)
+
+	if i := strings.IndexByte(base, '_'); i > 0 {
+		return base[:i]
+	}
+
+	return strings.TrimSuffix(base, path.Ext(base))
+}
+
+// CompareVersions orders versions numerically when both are numbers and as text otherwise
+func CompareVersions(a, b string) int {
+	if isDigits(a) && isDigits(b) {
+		a = strings.TrimLeft(a, "0")
+		b = strings.TrimLeft(b, "0")
+
+		if len(a) != len(b) {
+			if len(a) < len(b) {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	return strings.Compare(a, b)
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return true
+}